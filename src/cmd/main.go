@@ -2,55 +2,264 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/rs/cors"
 
+	"vktest/src/config"
 	"vktest/src/handler"
 	"vktest/src/storage"
 	"vktest/src/tools"
 )
 
+// The /api/v1 routes are deprecated in favour of /api/v2 and will be removed
+// at v1Sunset.
+var (
+	v1Deprecated = time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+	v1Sunset     = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// bootstrapAdmin creates an admin from -admin-user and -admin-password unless
+// a user with that name exists, so a fresh database has someone to sign in
+// as. An existing user keeps their password and role. The password must pass
+// the same length check as the users API.
+func bootstrapAdmin(ctx context.Context, store storage.Storage, username, password string) error {
+	if username == "" || password == "" {
+		log.Println("No bootstrap admin configured, set ADMIN_USERNAME and ADMIN_PASSWORD")
+		return nil
+	}
+	if !storage.ValidPassword(password) {
+		return fmt.Errorf("password must be %d to %d bytes long", storage.MinPasswordLength, storage.MaxPasswordLength)
+	}
+
+	_, err := store.GetUserByName(ctx, username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	hash, err := storage.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := store.CreateUser(ctx, username, hash, storage.UserRoleAdmin); err != nil && !errors.Is(err, storage.ErrUserExists) {
+		return err
+	}
+	log.Printf("Created bootstrap admin %q\n", username)
+	return nil
+}
+
+// healthInterval is how often the storage is pinged once the service runs.
+const healthInterval = 5 * time.Second
+
+// waitForStorage pings the storage until it answers, backing off from
+// 250ms to 5s between attempts, and gives up after timeout. It returns the
+// last error of the ping.
+func waitForStorage(ctx context.Context, pinger tools.Pinger, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := pinger.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		log.Printf("Storage is not ready (attempt %d), retrying in %s: %s\n", attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, 5*time.Second)
+	}
+}
+
+// signingKeys parses -jwt-keys. Without keys it makes up one, so access
+// tokens stop working on restart.
+func signingKeys(s string) ([]tools.SigningKey, error) {
+	keys, err := tools.ParseSigningKeys(s)
+	if err != nil || len(keys) > 0 {
+		return keys, err
+	}
+
+	log.Println("No signing keys configured, set JWT_KEYS; access tokens will not survive a restart")
+	key, err := tools.NewSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return []tools.SigningKey{key}, nil
+}
+
 func main() {
-	postgresURL := fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s",
-		"postgres", 5432, "program", "movies", "test")
-	psqlDB, err := storage.NewPgStorage(context.Background(), postgresURL)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateMain(os.Args[2:])
+		return
+	}
+
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file; the environment overrides it")
+	backend := flag.String("storage", "", "storage backend: postgres or memory (STORAGE)")
+	adminUser := flag.String("admin-user", "", "username of the bootstrap admin, created if missing (ADMIN_USERNAME)")
+	adminPassword := flag.String("admin-password", "", "password of the bootstrap admin (ADMIN_PASSWORD)")
+	jwtKeys := flag.String("jwt-keys", "", "access token signing keys as kid:secret,...; the first one signs (JWT_KEYS)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile)
 	if err != nil {
-		fmt.Printf("Postgresql init: %s", err)
-	} else {
-		fmt.Println("Connected to PostreSQL")
+		log.Fatalf("Config: %s", err)
 	}
-	defer psqlDB.Close()
+	cfg.ApplyFlags(config.Flags{
+		Storage:       *backend,
+		AdminUsername: *adminUser,
+		AdminPassword: *adminPassword,
+		JWTKeys:       *jwtKeys,
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Config: %s", err)
+	}
+	log.Printf("Config:\n%s", cfg)
+
+	var store storage.Storage
+	switch cfg.Storage {
+	case "memory":
+		store = storage.NewMemStorage()
+		fmt.Println("Using in-memory storage")
+	case "postgres":
+		psqlDB, err := storage.NewPgStorage(context.Background(), cfg.Database.DSN, cfg.Database.MaxConns, cfg.Database.MinConns)
+		if err != nil {
+			log.Fatalf("Postgres: %s", err)
+		}
+		defer psqlDB.Close()
+
+		if err := waitForStorage(context.Background(), psqlDB, cfg.Database.ConnectTimeout); err != nil {
+			log.Fatalf("Postgres: no connection within %s: %s", cfg.Database.ConnectTimeout, err)
+		}
+		fmt.Println("Connected to PostgreSQL")
 
-	handler := handler.NewHandler(psqlDB)
+		if err := migrateUp(context.Background(), cfg.Database.DSN); err != nil {
+			log.Fatalf("Migrations: %s", err)
+		}
+		store = psqlDB
+	}
+
+	if err := bootstrapAdmin(context.Background(), store, cfg.Auth.AdminUsername, cfg.Auth.AdminPassword); err != nil {
+		log.Fatalf("Bootstrap admin: %s", err)
+	}
+
+	keys, err := signingKeys(cfg.Auth.JWTKeys)
+	if err != nil {
+		log.Fatalf("Signing keys: %s", err)
+	}
+	tokens := tools.NewTokens(store, keys)
+	auth := tools.NewAuth(store, store, tokens)
+	handler := handler.NewHandler(store, tokens)
+
+	health := tools.NewHealth(store)
+	go health.Watch(context.Background(), healthInterval)
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/api/v1/get/movies", tools.RequestLogger(handler.GetMovies))
-	mux.HandleFunc("/api/v1/get/actors", tools.RequestLogger(handler.GetActors))
+	mux.Handle("GET /healthz", health)
+
+	mux.HandleFunc("GET /api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermRead, handler.GetMovies))
+	mux.HandleFunc("POST /api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.CreateMovie))
+	mux.HandleFunc("GET /api/v2/movies/search", auth.Require(tools.ResourceMovies, tools.PermRead, handler.SearchMovies))
+	mux.HandleFunc("GET /api/v2/movies/{id}", auth.Require(tools.ResourceMovies, tools.PermRead, handler.GetMovie))
+	mux.HandleFunc("PUT /api/v2/movies/{id}", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.UpdateMovie))
+	mux.HandleFunc("PATCH /api/v2/movies/{id}", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.PatchMovie))
+	mux.HandleFunc("DELETE /api/v2/movies/{id}", auth.Require(tools.ResourceMovies, tools.PermDelete, handler.DeleteMovie))
+	mux.HandleFunc("GET /api/v2/movies/{id}/actors", auth.Require(tools.ResourceMovies, tools.PermRead, handler.GetMovieActors))
+	mux.HandleFunc("POST /api/v2/movies/{id}/actors", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.AddMovieActors))
+	mux.HandleFunc("PUT /api/v2/movies/{id}/actors", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.ReplaceMovieActors))
+	mux.HandleFunc("PUT /api/v2/movies/{id}/actors/{actor_id}", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.AddMovieActor))
+	mux.HandleFunc("DELETE /api/v2/movies/{id}/actors/{actor_id}", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.RemoveMovieActor))
+	mux.HandleFunc("GET /api/v2/movies/{id}/genres", auth.Require(tools.ResourceMovies, tools.PermRead, handler.GetMovieGenres))
+	mux.HandleFunc("PUT /api/v2/movies/{id}/genres", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.SetMovieGenres))
+	mux.HandleFunc("GET /api/v2/movies/{id}/crew", auth.Require(tools.ResourceMovies, tools.PermRead, handler.GetMovieCrew))
+	mux.HandleFunc("PUT /api/v2/movies/{id}/crew", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.ReplaceMovieCrew))
+
+	mux.HandleFunc("GET /api/v2/actors", auth.Require(tools.ResourceActors, tools.PermRead, handler.GetActors))
+	mux.HandleFunc("POST /api/v2/actors", auth.Require(tools.ResourceActors, tools.PermEdit, handler.CreateActor))
+	mux.HandleFunc("GET /api/v2/actors/{id}", auth.Require(tools.ResourceActors, tools.PermRead, handler.GetActor))
+	mux.HandleFunc("PUT /api/v2/actors/{id}", auth.Require(tools.ResourceActors, tools.PermEdit, handler.UpdateActor))
+	mux.HandleFunc("PATCH /api/v2/actors/{id}", auth.Require(tools.ResourceActors, tools.PermEdit, handler.PatchActor))
+	mux.HandleFunc("DELETE /api/v2/actors/{id}", auth.Require(tools.ResourceActors, tools.PermDelete, handler.DeleteActor))
+	mux.HandleFunc("GET /api/v2/actors/{id}/movies", auth.Require(tools.ResourceActors, tools.PermRead, handler.GetActorMovies))
+
+	mux.HandleFunc("POST /api/v2/people", auth.Require(tools.ResourcePeople, tools.PermEdit, handler.CreatePerson))
+	mux.HandleFunc("GET /api/v2/people/{id}", auth.Require(tools.ResourcePeople, tools.PermRead, handler.GetPerson))
+	mux.HandleFunc("PUT /api/v2/people/{id}", auth.Require(tools.ResourcePeople, tools.PermEdit, handler.UpdatePerson))
+	mux.HandleFunc("PATCH /api/v2/people/{id}", auth.Require(tools.ResourcePeople, tools.PermEdit, handler.PatchPerson))
+	mux.HandleFunc("DELETE /api/v2/people/{id}", auth.Require(tools.ResourcePeople, tools.PermDelete, handler.DeletePerson))
+	mux.HandleFunc("GET /api/v2/people/{id}/filmography", auth.Require(tools.ResourcePeople, tools.PermRead, handler.GetPersonFilmography))
+
+	mux.HandleFunc("POST /api/v2/auth/login", handler.Login)
+	mux.HandleFunc("POST /api/v2/auth/refresh", handler.Refresh)
+	mux.HandleFunc("POST /api/v2/auth/logout", handler.Logout)
+
+	mux.HandleFunc("GET /api/v2/users", auth.Require(tools.ResourceUsers, tools.PermManageUsers, handler.GetUsers))
+	mux.HandleFunc("POST /api/v2/users", auth.Require(tools.ResourceUsers, tools.PermManageUsers, handler.CreateUser))
+	mux.HandleFunc("PUT /api/v2/users/{id}/password", auth.Require(tools.ResourceUsers, tools.PermAccount, handler.ChangePassword))
+	mux.HandleFunc("PUT /api/v2/users/{id}/status", auth.Require(tools.ResourceUsers, tools.PermManageUsers, handler.SetUserStatus))
+	mux.HandleFunc("PUT /api/v2/users/{id}/role", auth.Require(tools.ResourceUsers, tools.PermManageUsers, handler.SetUserRole))
 
-	mux.HandleFunc("/api/v1/post/movies", tools.RequestAuth(handler.CreateMovie))
-	mux.HandleFunc("/api/v1/post/actors", tools.RequestAuth(handler.CreateActor))
+	mux.HandleFunc("GET /api/v2/api-keys", auth.Require(tools.ResourceUsers, tools.PermManageKeys, handler.GetAPIKeys))
+	mux.HandleFunc("POST /api/v2/api-keys", auth.Require(tools.ResourceUsers, tools.PermManageKeys, handler.CreateAPIKey))
+	mux.HandleFunc("DELETE /api/v2/api-keys/{id}", auth.Require(tools.ResourceUsers, tools.PermManageKeys, handler.DeleteAPIKey))
 
-	mux.HandleFunc("/api/v1/delete/movies", tools.RequestAuth(handler.DeleteMovie))
-	mux.HandleFunc("/api/v1/delete/actors", tools.RequestAuth(handler.DeleteActor))
+	mux.HandleFunc("GET /api/v2/genres", auth.Require(tools.ResourceGenres, tools.PermRead, handler.GetGenres))
+	mux.HandleFunc("POST /api/v2/genres", auth.Require(tools.ResourceGenres, tools.PermEdit, handler.CreateGenre))
+	mux.HandleFunc("GET /api/v2/genres/{id}", auth.Require(tools.ResourceGenres, tools.PermRead, handler.GetGenre))
+	mux.HandleFunc("PUT /api/v2/genres/{id}", auth.Require(tools.ResourceGenres, tools.PermEdit, handler.UpdateGenre))
+	mux.HandleFunc("DELETE /api/v2/genres/{id}", auth.Require(tools.ResourceGenres, tools.PermDelete, handler.DeleteGenre))
 
-	mux.HandleFunc("/api/v1/upd/actors", tools.RequestAuth(handler.UpdateActor))
-	mux.HandleFunc("/api/v1/upd/movie", tools.RequestAuth(handler.UpdateMovie))
-	mux.HandleFunc("/api/v1/search/movies", tools.RequestLogger(handler.SearchMovies))
+	// v1 stays until its sunset date as deprecated aliases of v2.
+	v1 := func(successor string, next http.HandlerFunc) http.HandlerFunc {
+		return tools.Deprecated(next, v1Deprecated, v1Sunset, successor)
+	}
+
+	mux.HandleFunc("/api/v1/get/movies", v1("/api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermRead, handler.GetMovies)))
+	mux.HandleFunc("/api/v1/get/actors", v1("/api/v2/actors", auth.Require(tools.ResourceActors, tools.PermRead, handler.GetActors)))
+	mux.HandleFunc("/api/v1/get/movie", v1("/api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermRead, handler.GetMovie)))
+	mux.HandleFunc("/api/v1/get/actor", v1("/api/v2/actors", auth.Require(tools.ResourceActors, tools.PermRead, handler.GetActor)))
+
+	mux.HandleFunc("/api/v1/post/movies", v1("/api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.CreateMovie)))
+	mux.HandleFunc("/api/v1/post/actors", v1("/api/v2/actors", auth.Require(tools.ResourceActors, tools.PermEdit, handler.CreateActor)))
+
+	mux.HandleFunc("/api/v1/delete/movies", v1("/api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermDelete, handler.DeleteMovie)))
+	mux.HandleFunc("/api/v1/delete/actors", v1("/api/v2/actors", auth.Require(tools.ResourceActors, tools.PermDelete, handler.DeleteActor)))
+
+	mux.HandleFunc("/api/v1/upd/actors", v1("/api/v2/actors", auth.Require(tools.ResourceActors, tools.PermEdit, handler.UpdateActor)))
+	mux.HandleFunc("/api/v1/upd/movie", v1("/api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermEdit, handler.UpdateMovie)))
+	mux.HandleFunc("/api/v1/search/movies", v1("/api/v2/movies/search", auth.Require(tools.ResourceMovies, tools.PermRead, handler.SearchMovies)))
 
 	corsCustom := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
+		AllowedOrigins: cfg.CORS.Origins,
 		AllowedMethods: []string{"GET", "POST", "DELETE", "PUT", "PATCH", "OPTIONS"},
-		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID", "If-Match", "If-None-Match"},
+		ExposedHeaders: []string{"X-Request-ID", "ETag"},
 	})
 
-	corsHandler := corsCustom.Handler(mux)
+	corsHandler := corsCustom.Handler(tools.RequestID(mux))
 
-	log.Println("Starting server on :8080")
-	if err := http.ListenAndServe(":8080", corsHandler); err != nil {
-		log.Fatal(err)
+	if cfg.TLS.Enabled() {
+		log.Printf("Starting server on %s with TLS", cfg.Listen)
+		err = http.ListenAndServeTLS(cfg.Listen, cfg.TLS.CertFile, cfg.TLS.KeyFile, corsHandler)
+	} else {
+		log.Printf("Starting server on %s", cfg.Listen)
+		err = http.ListenAndServe(cfg.Listen, corsHandler)
 	}
+	log.Fatal(err)
 }
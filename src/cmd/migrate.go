@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"vktest/src/config"
+	"vktest/src/migrate"
+)
+
+const migrateUsage = `usage: movie migrate <command>
+
+commands:
+  up           apply all pending migrations
+  down [N]     revert the last N migrations (default 1)
+  status       print the applied version and pending migrations
+  force V      record version V as applied and clear the dirty flag`
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return err
+	}
+	cfg.Storage = "postgres"
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	migrator, err := migrate.New(ctx, cfg.Database.DSN)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close(ctx)
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("down: invalid number of steps %q", args[1])
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d\ndirty: %t\n", status.Version, status.Dirty)
+		for _, mig := range status.Pending {
+			fmt.Printf("pending: %04d_%s\n", mig.Version, mig.Name)
+		}
+		return nil
+	case "force":
+		if len(args) < 2 {
+			return fmt.Errorf("force: version is required")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("force: invalid version %q", args[1])
+		}
+		return migrator.Force(ctx, version)
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", args[0], migrateUsage)
+	}
+}
+
+// migrateUp brings the schema up to date before the service starts.
+func migrateUp(ctx context.Context, dsn string) error {
+	migrator, err := migrate.New(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close(ctx)
+
+	return migrator.Up(ctx)
+}
+
+func migrateMain(args []string) {
+	if err := runMigrate(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,271 @@
+// Package config loads the settings of the service. The defaults are
+// overridden by an optional YAML file, and the file by the environment.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the effective configuration of the service.
+type Config struct {
+	Storage  string   `yaml:"storage"`
+	Listen   string   `yaml:"listen"`
+	TLS      TLS      `yaml:"tls"`
+	Database Database `yaml:"database"`
+	CORS     CORS     `yaml:"cors"`
+	Auth     Auth     `yaml:"auth"`
+}
+
+// Database is the Postgres connection pool. At startup the service waits up
+// to ConnectTimeout for the database to answer.
+type Database struct {
+	DSN            string        `yaml:"dsn"`
+	MaxConns       int32         `yaml:"max_conns"`
+	MinConns       int32         `yaml:"min_conns"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+}
+
+// TLS makes the service serve HTTPS with the certificate and key files.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Enabled reports whether the service serves HTTPS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// CORS lists the origins that browsers may call the API from, "*" for any.
+type CORS struct {
+	Origins []string `yaml:"origins"`
+}
+
+// Auth is the bootstrap admin and the access token signing keys, written as
+// kid:secret,kid:secret.
+type Auth struct {
+	AdminUsername string `yaml:"admin_username"`
+	AdminPassword string `yaml:"admin_password"`
+	JWTKeys       string `yaml:"jwt_keys"`
+}
+
+// Default returns the configuration without a file or environment. It has
+// no DSN, so postgres needs one.
+func Default() Config {
+	return Config{
+		Storage: "postgres",
+		Listen:  ":8080",
+		Database: Database{
+			MaxConns:       10,
+			ConnectTimeout: 30 * time.Second,
+		},
+		CORS: CORS{
+			Origins: []string{"*"},
+		},
+	}
+}
+
+// Load reads the file at path, if any, over the defaults and then the
+// environment over it. Unknown keys in the file are errors. The result is
+// not validated, so that flags can still change it.
+func Load(path string) (Config, error) {
+	c := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("unable to read config: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			return c, fmt.Errorf("unable to parse config %s: %w", path, err)
+		}
+	}
+
+	if err := c.applyEnv(os.Getenv); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// applyEnv overrides the fields whose variables are set and not empty.
+func (c *Config) applyEnv(getenv func(string) string) error {
+	for name, dst := range map[string]*string{
+		"STORAGE":        &c.Storage,
+		"LISTEN_ADDR":    &c.Listen,
+		"TLS_CERT_FILE":  &c.TLS.CertFile,
+		"TLS_KEY_FILE":   &c.TLS.KeyFile,
+		"DATABASE_URL":   &c.Database.DSN,
+		"ADMIN_USERNAME": &c.Auth.AdminUsername,
+		"ADMIN_PASSWORD": &c.Auth.AdminPassword,
+		"JWT_KEYS":       &c.Auth.JWTKeys,
+	} {
+		if v := getenv(name); v != "" {
+			*dst = v
+		}
+	}
+
+	for name, dst := range map[string]*int32{
+		"DB_MAX_CONNS": &c.Database.MaxConns,
+		"DB_MIN_CONNS": &c.Database.MinConns,
+	} {
+		if v := getenv(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				return fmt.Errorf("%s must be a number, got %q", name, v)
+			}
+			*dst = int32(n)
+		}
+	}
+
+	if v := getenv("DB_CONNECT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("DB_CONNECT_TIMEOUT must be a duration such as 30s, got %q", v)
+		}
+		c.Database.ConnectTimeout = d
+	}
+
+	if v := getenv("CORS_ORIGINS"); v != "" {
+		c.CORS.Origins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.CORS.Origins = append(c.CORS.Origins, origin)
+			}
+		}
+	}
+	return nil
+}
+
+// Flags are the command line overrides, which win over the file and the
+// environment. Empty flags leave the settings as they are.
+type Flags struct {
+	Storage       string
+	AdminUsername string
+	AdminPassword string
+	JWTKeys       string
+}
+
+// ApplyFlags overrides the fields whose flags are set.
+func (c *Config) ApplyFlags(f Flags) {
+	for _, o := range []struct{ flag, dst *string }{
+		{&f.Storage, &c.Storage},
+		{&f.AdminUsername, &c.Auth.AdminUsername},
+		{&f.AdminPassword, &c.Auth.AdminPassword},
+		{&f.JWTKeys, &c.Auth.JWTKeys},
+	} {
+		if *o.flag != "" {
+			*o.dst = *o.flag
+		}
+	}
+}
+
+// Validate returns all the problems of the configuration joined.
+func (c Config) Validate() error {
+	var errs []error
+
+	switch c.Storage {
+	case "postgres":
+		if c.Database.DSN == "" {
+			errs = append(errs, errors.New("database DSN is required for postgres storage, set DATABASE_URL"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage backend %q", c.Storage))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("invalid listen address %q: %w", c.Listen, err))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("TLS needs both the certificate and the key file"))
+	}
+
+	if c.Database.MaxConns < 1 {
+		errs = append(errs, fmt.Errorf("database max_conns must be at least 1, got %d", c.Database.MaxConns))
+	}
+	if c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		errs = append(errs, fmt.Errorf("database min_conns must be between 0 and max_conns, got %d", c.Database.MinConns))
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("database connect_timeout must be positive, got %s", c.Database.ConnectTimeout))
+	}
+
+	for _, origin := range c.CORS.Origins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			errs = append(errs, fmt.Errorf("CORS origin %q must be * or scheme://host[:port]", origin))
+		}
+	}
+
+	if (c.Auth.AdminUsername == "") != (c.Auth.AdminPassword == "") {
+		errs = append(errs, errors.New("the bootstrap admin needs both a username and a password"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// redacted replaces secrets.
+const redacted = "xxxxx"
+
+// dsnPassword is the password of a keyword/value DSN, quoted or not.
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted returns the configuration with its secrets replaced, for logs.
+func (c Config) Redacted() Config {
+	c.CORS.Origins = append([]string(nil), c.CORS.Origins...)
+
+	if u, err := url.Parse(c.Database.DSN); err == nil && u.Scheme != "" {
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		c.Database.DSN = u.Redacted()
+	} else {
+		c.Database.DSN = dsnPassword.ReplaceAllString(c.Database.DSN, "${1}"+redacted)
+	}
+
+	if c.Auth.AdminPassword != "" {
+		c.Auth.AdminPassword = redacted
+	}
+
+	// Key IDs are not secret and tell which keys are loaded.
+	var keys []string
+	for _, entry := range strings.Split(c.Auth.JWTKeys, ",") {
+		if id, _, ok := strings.Cut(strings.TrimSpace(entry), ":"); ok {
+			keys = append(keys, id+":"+redacted)
+		} else if entry != "" {
+			keys = append(keys, redacted)
+		}
+	}
+	c.Auth.JWTKeys = strings.Join(keys, ",")
+
+	return c
+}
+
+// String returns the redacted configuration as YAML.
+func (c Config) String() string {
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return b.String()
+}
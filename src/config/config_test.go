@@ -0,0 +1,215 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedacted(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{"url", "postgres://program:s3cret@db:5432/movies?sslmode=disable",
+			"postgres://program:xxxxx@db:5432/movies?sslmode=disable"},
+		{"url password parameter", "postgres://program@db/movies?password=s3cret",
+			"postgres://program@db/movies?password=xxxxx"},
+		{"url without password", "postgres://program@db/movies", "postgres://program@db/movies"},
+		{"keywords", "host=db user=program password=s3cret dbname=movies",
+			"host=db user=program password=xxxxx dbname=movies"},
+		{"keywords quoted", `host=db password = 's3 cr\'et' dbname=movies`,
+			"host=db password = xxxxx dbname=movies"},
+		{"keywords without password", "host=db user=program", "host=db user=program"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			c.Database.DSN = tt.dsn
+			if got := c.Redacted().Database.DSN; got != tt.want {
+				t.Errorf("DSN = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(c.String(), "s3") {
+				t.Errorf("String() leaks the password:\n%s", c)
+			}
+		})
+	}
+}
+
+func TestRedactedAuth(t *testing.T) {
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"", ""},
+		{"k2:second-secret-second-secret-se", "k2:xxxxx"},
+		{"k2:second-secret-second-secret-se, k1:first-secret-first-secret-first", "k2:xxxxx,k1:xxxxx"},
+		{"no-kid-secret", "xxxxx"},
+	}
+	for _, tt := range tests {
+		c := Default()
+		c.Auth = Auth{AdminUsername: "abc", AdminPassword: "change-me-123", JWTKeys: tt.keys}
+
+		r := c.Redacted()
+		if r.Auth.JWTKeys != tt.want {
+			t.Errorf("JWTKeys %q = %q, want %q", tt.keys, r.Auth.JWTKeys, tt.want)
+		}
+		if r.Auth.AdminPassword != redacted || r.Auth.AdminUsername != "abc" {
+			t.Errorf("admin = %q/%q, want abc/%s", r.Auth.AdminUsername, r.Auth.AdminPassword, redacted)
+		}
+		for _, secret := range []string{"secret", "change-me"} {
+			if strings.Contains(c.String(), secret) {
+				t.Errorf("String() leaks %q:\n%s", secret, c)
+			}
+		}
+		if c.Auth.JWTKeys != tt.keys {
+			t.Errorf("Redacted changed the config itself")
+		}
+	}
+}
+
+// clearEnv unsets the variables of applyEnv for the test.
+func clearEnv(t *testing.T) {
+	for _, name := range []string{"STORAGE", "LISTEN_ADDR", "TLS_CERT_FILE", "TLS_KEY_FILE", "DATABASE_URL",
+		"ADMIN_USERNAME", "ADMIN_PASSWORD", "JWT_KEYS", "DB_MAX_CONNS", "DB_MIN_CONNS", "DB_CONNECT_TIMEOUT", "CORS_ORIGINS"} {
+		t.Setenv(name, "")
+	}
+}
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, `
+storage: memory
+listen: ":9000"
+database:
+  max_conns: 5
+  min_conns: 1
+auth:
+  admin_username: file-admin
+  admin_password: file-password
+cors:
+  origins: ["https://file.example"]
+`)
+	t.Setenv("LISTEN_ADDR", ":9001")
+	t.Setenv("ADMIN_USERNAME", "env-admin")
+	t.Setenv("DB_MAX_CONNS", "7")
+	t.Setenv("CORS_ORIGINS", "https://a.example, https://b.example")
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	c.ApplyFlags(Flags{AdminUsername: "flag-admin"})
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"storage from the file", c.Storage, "memory"},
+		{"listen from the env", c.Listen, ":9001"},
+		{"max_conns from the env", c.Database.MaxConns, int32(7)},
+		{"min_conns from the file", c.Database.MinConns, int32(1)},
+		{"connect_timeout by default", c.Database.ConnectTimeout, Default().Database.ConnectTimeout},
+		{"admin from the flag", c.Auth.AdminUsername, "flag-admin"},
+		{"password from the file", c.Auth.AdminPassword, "file-password"},
+		{"origins from the env", strings.Join(c.CORS.Origins, " "), "https://a.example https://b.example"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want string
+	}{
+		{"unknown key", "storage: memory\nlisten_addr: \":9000\"\n", nil, "listen_addr"},
+		{"bad yaml", "storage: [memory\n", nil, "unable to parse config"},
+		{"bad number", "", map[string]string{"DB_MAX_CONNS": "ten"}, "DB_MAX_CONNS"},
+		{"bad duration", "", map[string]string{"DB_CONNECT_TIMEOUT": "30"}, "DB_CONNECT_TIMEOUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if _, err := Load(writeFile(t, tt.file)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		c := Default()
+		c.Database.DSN = "postgres://program@db/movies"
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{"default with a DSN", func(c *Config) {}, nil},
+		{"tls", func(c *Config) { c.TLS = TLS{CertFile: "cert.pem", KeyFile: "key.pem"} }, nil},
+		{"tls without the key", func(c *Config) { c.TLS.CertFile = "cert.pem" }, []string{"TLS"}},
+		{"tls without the certificate", func(c *Config) { c.TLS.KeyFile = "key.pem" }, []string{"TLS"}},
+		{"min_conns over max_conns", func(c *Config) { c.Database.MinConns, c.Database.MaxConns = 5, 4 }, []string{"min_conns"}},
+		{"negative min_conns", func(c *Config) { c.Database.MinConns = -1 }, []string{"min_conns"}},
+		{"no max_conns", func(c *Config) { c.Database.MaxConns = 0 }, []string{"max_conns must be at least 1"}},
+		{"postgres without a DSN", func(c *Config) { c.Database.DSN = "" }, []string{"DATABASE_URL"}},
+		{"memory without a DSN", func(c *Config) { c.Storage, c.Database.DSN = "memory", "" }, nil},
+		{"unknown storage", func(c *Config) { c.Storage = "mysql" }, []string{"mysql"}},
+		{"bad listen", func(c *Config) { c.Listen = "8080" }, []string{"listen"}},
+		{"bad origin", func(c *Config) { c.CORS.Origins = []string{"example.com"} }, []string{"example.com"}},
+		{"admin without a password", func(c *Config) { c.Auth.AdminUsername = "abc" }, []string{"bootstrap admin"}},
+		{"all problems at once", func(c *Config) {
+			c.TLS.KeyFile = "key.pem"
+			c.Database.MinConns = 20
+			c.Database.ConnectTimeout = 0
+		}, []string{"TLS", "min_conns", "connect_timeout"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.change(&c)
+			err := c.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate = nil, want errors about %v", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate = %v, want an error about %s", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+// CreateAPIKeyRequest names the key and lists its scopes, see tools.Scopes.
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedAPIKeyResponse is the only response that carries the key itself.
+type CreatedAPIKeyResponse struct {
+	storage.APIKey
+	Key string `json:"key"`
+}
+
+// GetAPIKeys lists every API key, without the keys themselves.
+func (h *Handler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+
+	keys, err := h.storage.GetAPIKeys(context.Background())
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get api keys: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKey creates a key and responds with it. The key is not stored,
+// so this is the only time it is shown.
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var keyBody CreateAPIKeyRequest
+
+	if err := decodeBody(r.Body, &keyBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	name := strings.TrimSpace(keyBody.Name)
+	if name == "" || len(name) > 80 {
+		writeFieldErrors(w, tools.FieldError{Field: "name", Message: "must be 1 to 80 characters long"})
+		return
+	}
+	if len(keyBody.Scopes) == 0 {
+		writeFieldErrors(w, tools.FieldError{Field: "scopes", Message: "must list at least one scope"})
+		return
+	}
+	allowed := tools.Scopes()
+	for _, scope := range keyBody.Scopes {
+		if !slices.Contains(allowed, scope) {
+			writeFieldErrors(w, tools.FieldError{
+				Field:   "scopes",
+				Message: fmt.Sprintf("unknown scope %q, allowed scopes: %s", scope, strings.Join(allowed, ", ")),
+			})
+			return
+		}
+	}
+	slices.Sort(keyBody.Scopes)
+
+	secret, key, err := tools.NewAPIKey(name, slices.Compact(keyBody.Scopes))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	key, err = h.storage.CreateAPIKey(context.Background(), key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedAPIKeyResponse{
+		APIKey: key,
+		Key:    secret,
+	})
+}
+
+// DeleteAPIKey revokes the key; requests with it are unauthorized from now
+// on.
+func (h *Handler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid API Key ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.storage.DeleteAPIKey(context.Background(), keyId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
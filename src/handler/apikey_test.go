@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"vktest/src/storage"
+)
+
+const testMovie = `{"title": "Alien", "description": "In space no one can hear you scream", "release_date": "1979-05-25", "rating": 9}`
+
+// mustCreateAPIKey creates a key with the scopes through the API, as the
+// admin signed in with adminAuth.
+func (s *testServer) mustCreateAPIKey(t *testing.T, adminAuth string, scopes ...string) CreatedAPIKeyResponse {
+	t.Helper()
+	body, _ := json.Marshal(CreateAPIKeyRequest{Name: "test", Scopes: scopes})
+	w := s.do(http.MethodPost, "/api/v2/api-keys", string(body), "Authorization", adminAuth)
+	wantStatus(t, w, http.StatusCreated)
+
+	var key CreatedAPIKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&key); err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	if !strings.HasPrefix(key.Key, key.Prefix) {
+		t.Fatalf("key %q does not start with its prefix %q", key.Key, key.Prefix)
+	}
+	return key
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	s := newTestServer(t)
+	_, adminAuth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+	reader := s.mustCreateAPIKey(t, adminAuth, "movies:read")
+	writer := s.mustCreateAPIKey(t, adminAuth, "movies:read", "movies:write")
+
+	wantStatus(t, s.do(http.MethodGet, "/api/v2/movies", "", "X-API-Key", reader.Key), http.StatusOK)
+	wantStatus(t, s.do(http.MethodPost, "/api/v2/movies", testMovie, "X-API-Key", reader.Key), http.StatusForbidden)
+	wantStatus(t, s.do(http.MethodGet, "/api/v2/actors", "", "X-API-Key", reader.Key), http.StatusForbidden)
+	wantStatus(t, s.do(http.MethodPost, "/api/v2/movies", testMovie, "X-API-Key", writer.Key), http.StatusCreated)
+	wantStatus(t, s.do(http.MethodGet, "/api/v2/movies", "", "X-API-Key", "mk_unknown"), http.StatusUnauthorized)
+}
+
+func TestAPIKeyRevoked(t *testing.T) {
+	s := newTestServer(t)
+	_, adminAuth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+	key := s.mustCreateAPIKey(t, adminAuth, "movies:read")
+
+	wantStatus(t, s.do(http.MethodGet, "/api/v2/movies", "", "X-API-Key", key.Key), http.StatusOK)
+	path := fmt.Sprintf("/api/v2/api-keys/%d", key.ID)
+	wantStatus(t, s.do(http.MethodDelete, path, "", "Authorization", adminAuth), http.StatusNoContent)
+	wantStatus(t, s.do(http.MethodGet, "/api/v2/movies", "", "X-API-Key", key.Key), http.StatusUnauthorized)
+}
+
+func TestAPIKeyCannotManageAccounts(t *testing.T) {
+	s := newTestServer(t)
+	_, adminAuth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+	key := s.mustCreateAPIKey(t, adminAuth, "movies:read", "movies:write", "movies:delete",
+		"actors:read", "actors:write", "actors:delete", "people:read", "people:write", "people:delete",
+		"genres:read", "genres:write", "genres:delete")
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{http.MethodGet, "/api/v2/users", ""},
+		{http.MethodPut, "/api/v2/users/1/password", `{"password": "a new password"}`},
+		{http.MethodGet, "/api/v2/api-keys", ""},
+		{http.MethodPost, "/api/v2/api-keys", `{"name": "escalated", "scopes": ["movies:read"]}`},
+		{http.MethodDelete, fmt.Sprintf("/api/v2/api-keys/%d", key.ID), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			wantStatus(t, s.do(tt.method, tt.path, tt.body, "X-API-Key", key.Key), http.StatusForbidden)
+		})
+	}
+}
+
+func TestAPIKeyLastUsed(t *testing.T) {
+	s := newTestServer(t)
+	_, adminAuth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+	key := s.mustCreateAPIKey(t, adminAuth, "movies:read")
+	if key.LastUsedAt != nil {
+		t.Fatalf("new key last used at %v", key.LastUsedAt)
+	}
+
+	lastUsed := func() *time.Time {
+		t.Helper()
+		keys, err := s.store.GetAPIKeys(context.Background())
+		if err != nil || len(keys) != 1 {
+			t.Fatalf("GetAPIKeys = %v, %v", keys, err)
+		}
+		return keys[0].LastUsedAt
+	}
+
+	wantStatus(t, s.do(http.MethodGet, "/api/v2/movies", "", "X-API-Key", key.Key), http.StatusOK)
+	first := lastUsed()
+	if first == nil {
+		t.Fatal("last_used_at is not set after a request")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	// Requests that the scope does not allow count as use too.
+	wantStatus(t, s.do(http.MethodPost, "/api/v2/movies", testMovie, "X-API-Key", key.Key), http.StatusForbidden)
+	if second := lastUsed(); second == nil || !second.After(*first) {
+		t.Errorf("last_used_at = %v after a later request, want after %v", second, first)
+	}
+}
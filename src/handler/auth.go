@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Login swaps a username and password for an access and refresh token pair.
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var loginBody LoginRequest
+
+	if err := decodeBody(r.Body, &loginBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	user, ok, err := tools.Authenticate(context.Background(), h.storage, loginBody.Username, loginBody.Password)
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get user: %w", err))
+		return
+	}
+	if !ok {
+		tools.Error(w, tools.CodeUnauthorized, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	pair, err := h.tokens.Issue(context.Background(), user)
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to issue tokens: %w", err))
+		return
+	}
+	writeTokenPair(w, pair)
+}
+
+// Refresh swaps a refresh token for a new pair. The old refresh token stops
+// working; using it again signs out every session that descends from it.
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var refreshBody RefreshRequest
+
+	if err := decodeBody(r.Body, &refreshBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	pair, err := h.tokens.Refresh(context.Background(), refreshBody.RefreshToken)
+	if errors.Is(err, storage.ErrInvalidToken) {
+		tools.Error(w, tools.CodeInvalidToken, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to refresh tokens: %w", err))
+		return
+	}
+	writeTokenPair(w, pair)
+}
+
+// Logout revokes the refresh token of the body with its whole family and the
+// Bearer access token of the request, if any. Tokens that are already
+// invalid are ignored.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	var refreshBody RefreshRequest
+
+	if err := decodeBody(r.Body, &refreshBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	var claims *tools.AccessClaims
+	if token, ok := tools.BearerToken(r); ok {
+		var err error
+		claims, err = h.tokens.Verify(context.Background(), token)
+		if err != nil && !errors.Is(err, storage.ErrInvalidToken) {
+			writeError(w, fmt.Errorf("failed to verify token: %w", err))
+			return
+		}
+	}
+
+	err := h.tokens.Revoke(context.Background(), claims, refreshBody.RefreshToken)
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to revoke tokens: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeTokenPair(w http.ResponseWriter, pair tools.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(pair)
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+// writeError responds to an error of the storage: 422 for unknown IDs and
+// invalid data, 409 for conflicts, 404 for missing rows and 500 for the
+// rest.
+func writeError(w http.ResponseWriter, err error) {
+	var (
+		actorsErr *storage.UnknownActorsError
+		genresErr *storage.UnknownGenresError
+		peopleErr *storage.UnknownPeopleError
+	)
+	switch {
+	case errors.As(err, &actorsErr):
+		tools.WriteProblem(w, tools.Problem{
+			Status:   http.StatusUnprocessableEntity,
+			Code:     tools.CodeUnknownActors,
+			Detail:   actorsErr.Error(),
+			ActorIDs: actorsErr.IDs,
+		})
+	case errors.As(err, &genresErr):
+		tools.WriteProblem(w, tools.Problem{
+			Status:   http.StatusUnprocessableEntity,
+			Code:     tools.CodeUnknownGenres,
+			Detail:   genresErr.Error(),
+			GenreIDs: genresErr.IDs,
+		})
+	case errors.As(err, &peopleErr):
+		tools.WriteProblem(w, tools.Problem{
+			Status:    http.StatusUnprocessableEntity,
+			Code:      tools.CodeUnknownPeople,
+			Detail:    peopleErr.Error(),
+			PersonIDs: peopleErr.IDs,
+		})
+	case errors.Is(err, storage.ErrValidation):
+		tools.Error(w, tools.CodeValidation, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, storage.ErrVersionMismatch):
+		tools.Error(w, tools.CodePreconditionFailed, "The resource has changed since it was read", http.StatusPreconditionFailed)
+	case errors.Is(err, storage.ErrConflict):
+		tools.Error(w, tools.CodeConflict, err.Error(), http.StatusConflict)
+	case errors.Is(err, storage.ErrNotFound):
+		tools.Error(w, tools.CodeNotFound, "Not found", http.StatusNotFound)
+	default:
+		tools.InternalError(w, err)
+	}
+}
+
+// writeBodyError responds with 400 to a request body that does not decode,
+// naming the field of a value of the wrong type or that is not known.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		tools.WriteProblem(w, tools.Problem{
+			Status: http.StatusBadRequest,
+			Code:   tools.CodeInvalidBody,
+			Detail: "Invalid request body",
+			Errors: []tools.FieldError{{
+				Field:   typeErr.Field,
+				Message: fmt.Sprintf("must be %s, not %s", jsonType(typeErr.Type), typeErr.Value),
+			}},
+		})
+		return
+	}
+	if field, ok := unknownField(err); ok {
+		tools.WriteProblem(w, tools.Problem{
+			Status: http.StatusBadRequest,
+			Code:   tools.CodeInvalidBody,
+			Detail: "Invalid request body",
+			Errors: []tools.FieldError{{Field: field, Message: "is not a known field"}},
+		})
+		return
+	}
+	tools.Error(w, tools.CodeInvalidBody, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+}
+
+// writeParamError responds with 400 to an invalid query parameter.
+func writeParamError(w http.ResponseWriter, err error) {
+	var fieldErr tools.FieldError
+	if errors.As(err, &fieldErr) {
+		tools.WriteProblem(w, tools.Problem{
+			Status: http.StatusBadRequest,
+			Code:   tools.CodeInvalidParameter,
+			Detail: err.Error(),
+			Errors: []tools.FieldError{fieldErr},
+		})
+		return
+	}
+	tools.Error(w, tools.CodeInvalidParameter, err.Error(), http.StatusBadRequest)
+}
+
+// writeFieldErrors responds with 422 to a request body with invalid fields.
+func writeFieldErrors(w http.ResponseWriter, errs ...tools.FieldError) {
+	tools.WriteProblem(w, tools.Problem{
+		Status: http.StatusUnprocessableEntity,
+		Code:   tools.CodeValidation,
+		Detail: "Some fields are invalid",
+		Errors: errs,
+	})
+}
+
+// jsonType names the JSON type that decodes into t.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   tools.ErrorCode
+		check  func(t *testing.T, p tools.Problem)
+	}{
+		{"unknown actors", fmt.Errorf("unable to insert row: %w", &storage.UnknownActorsError{IDs: []int{3, 4}}),
+			http.StatusUnprocessableEntity, tools.CodeUnknownActors, func(t *testing.T, p tools.Problem) {
+				if !slices.Equal(p.ActorIDs, []int{3, 4}) {
+					t.Errorf("actor_ids = %v, want [3 4]", p.ActorIDs)
+				}
+			}},
+		{"unknown genres", &storage.UnknownGenresError{IDs: []int{5}},
+			http.StatusUnprocessableEntity, tools.CodeUnknownGenres, func(t *testing.T, p tools.Problem) {
+				if !slices.Equal(p.GenreIDs, []int{5}) {
+					t.Errorf("genre_ids = %v, want [5]", p.GenreIDs)
+				}
+			}},
+		{"unknown people", &storage.UnknownPeopleError{IDs: []int{6}},
+			http.StatusUnprocessableEntity, tools.CodeUnknownPeople, func(t *testing.T, p tools.Problem) {
+				if !slices.Equal(p.PersonIDs, []int{6}) {
+					t.Errorf("person_ids = %v, want [6]", p.PersonIDs)
+				}
+			}},
+		{"validation", fmt.Errorf("limit must not be negative: %w", storage.ErrValidation),
+			http.StatusUnprocessableEntity, tools.CodeValidation, nil},
+		{"version mismatch", fmt.Errorf("unable to update row: %w", storage.ErrVersionMismatch),
+			http.StatusPreconditionFailed, tools.CodePreconditionFailed, nil},
+		{"conflict", fmt.Errorf("unable to insert row: %w", storage.ErrConflict),
+			http.StatusConflict, tools.CodeConflict, nil},
+		{"not found", fmt.Errorf("unable to query: %w", storage.ErrNotFound),
+			http.StatusNotFound, tools.CodeNotFound, nil},
+		{"unavailable", fmt.Errorf("unable to query: %w", storage.ErrUnavailable),
+			http.StatusServiceUnavailable, tools.CodeUnavailable, nil},
+		{"internal", errors.New("connection to 10.0.0.5 reset"),
+			http.StatusInternalServerError, tools.CodeInternal, func(t *testing.T, p tools.Problem) {
+				if strings.Contains(p.Detail, "10.0.0.5") {
+					t.Errorf("detail %q leaks the error", p.Detail)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, tt.err)
+
+			wantStatus(t, w, tt.status)
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", ct)
+			}
+
+			var raw map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			want := map[string]any{
+				"type":   "about:blank",
+				"title":  http.StatusText(tt.status),
+				"status": float64(tt.status),
+				"code":   string(tt.code),
+			}
+			for k, v := range want {
+				if raw[k] != v {
+					t.Errorf("%s = %v, want %v", k, raw[k], v)
+				}
+			}
+			if detail, _ := raw["detail"].(string); detail == "" {
+				t.Error("detail is empty")
+			}
+
+			if tt.check != nil {
+				var p tools.Problem
+				json.Unmarshal(w.Body.Bytes(), &p)
+				tt.check(t, p)
+			}
+		})
+	}
+}
+
+// The codes are part of the API: clients match on them, so they must not
+// change.
+func TestErrorCodesAreStable(t *testing.T) {
+	codes := map[tools.ErrorCode]string{
+		tools.CodeInvalidBody:          "invalid_body",
+		tools.CodeInvalidParameter:     "invalid_parameter",
+		tools.CodeValidation:           "validation_failed",
+		tools.CodeUnknownActors:        "unknown_actors",
+		tools.CodeUnknownGenres:        "unknown_genres",
+		tools.CodeUnknownPeople:        "unknown_people",
+		tools.CodeNotFound:             "not_found",
+		tools.CodeConflict:             "conflict",
+		tools.CodePreconditionFailed:   "precondition_failed",
+		tools.CodePreconditionRequired: "precondition_required",
+		tools.CodeMethodNotAllowed:     "method_not_allowed",
+		tools.CodeUnsupportedMediaType: "unsupported_media_type",
+		tools.CodeUnauthorized:         "unauthorized",
+		tools.CodeInvalidToken:         "invalid_token",
+		tools.CodeForbidden:            "forbidden",
+		tools.CodeInternal:             "internal_error",
+		tools.CodeUnavailable:          "unavailable",
+	}
+	for code, want := range codes {
+		if string(code) != want {
+			t.Errorf("code %q, want %q", code, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vktest/src/tools"
+)
+
+// etag is the ETag of a movie or person of the version.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatch reads the version of the If-Match header of a change, 0 for "*".
+// /api/v2 requires the header, so that changes are made against the version
+// the client has seen; /api/v1 clients that do not send it skip the check.
+// A tag that is not a version of ours is -1, which never matches. On failure
+// it writes the error response and reports false.
+func ifMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if r.PathValue("id") == "" {
+			return 0, true
+		}
+		tools.Error(w, tools.CodePreconditionRequired, "If-Match with the ETag of the resource is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+	if strings.Contains(header, ",") {
+		writeParamError(w, tools.FieldError{Field: "If-Match", Message: "must be a single ETag or *"})
+		return 0, false
+	}
+
+	// Weak tags never match, as If-Match compares strongly.
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return -1, true
+	}
+	version, err := strconv.Atoi(header[1 : len(header)-1])
+	if err != nil || version < 1 {
+		return -1, true
+	}
+	return version, true
+}
+
+// notModified sets the ETag of the response and reports whether the
+// If-None-Match header of the request matches it, in which case it responds
+// with 304. If-None-Match compares weakly.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// writeCacheable responds with v and a weak ETag of its encoding, or with
+// 304 when the client has it already. It is for lists, which have no version
+// of their own.
+func writeCacheable(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to encode response: %w", err))
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	if notModified(w, r, `W/"`+hex.EncodeToString(sum[:16])+`"`) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+// mustCreateMovie creates testMovie and returns the path and ETag of it.
+func (s *testServer) mustCreateMovie(t *testing.T, auth string) (string, string) {
+	t.Helper()
+	wantStatus(t, s.do(http.MethodPost, "/api/v2/movies", testMovie, "Authorization", auth), http.StatusCreated)
+	return "/api/v2/movies/1", s.etag(t, "/api/v2/movies/1")
+}
+
+// etag returns the ETag of a GET of the path.
+func (s *testServer) etag(t *testing.T, path string) string {
+	t.Helper()
+	w := s.do(http.MethodGet, path, "")
+	wantStatus(t, w, http.StatusOK)
+	tag := w.Header().Get("ETag")
+	if tag == "" {
+		t.Fatalf("GET %s has no ETag", path)
+	}
+	return tag
+}
+
+func TestIfMatch(t *testing.T) {
+	s := newTestServer(t)
+	_, auth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+	path, tag := s.mustCreateMovie(t, auth)
+
+	update := func(body string, header ...string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPut, path, body, append([]string{"Authorization", auth}, header...)...)
+	}
+
+	wantCode(t, update(`{"title": "Alien"}`), http.StatusPreconditionRequired, tools.CodePreconditionRequired)
+	wantCode(t, s.do(http.MethodDelete, path, "", "Authorization", auth), http.StatusPreconditionRequired, tools.CodePreconditionRequired)
+
+	wantStatus(t, update(`{"rating": 8}`, "If-Match", tag), http.StatusOK)
+	newTag := s.etag(t, path)
+	if newTag == tag {
+		t.Fatalf("ETag %s did not change with the movie", tag)
+	}
+	wantCode(t, update(`{"rating": 7}`, "If-Match", tag), http.StatusPreconditionFailed, tools.CodePreconditionFailed)
+	wantCode(t, update(`{"rating": 7}`, "If-Match", "W/"+newTag), http.StatusPreconditionFailed, tools.CodePreconditionFailed)
+	wantCode(t, update(`{"rating": 7}`, "If-Match", `"not a version"`), http.StatusPreconditionFailed, tools.CodePreconditionFailed)
+	wantCode(t, update(`{"rating": 7}`, "If-Match", tag+", "+newTag), http.StatusBadRequest, tools.CodeInvalidParameter)
+
+	wantStatus(t, update(`{"rating": 6}`, "If-Match", "*"), http.StatusOK)
+	wantStatus(t, s.do(http.MethodDelete, path, "", "Authorization", auth, "If-Match", tag), http.StatusPreconditionFailed)
+	wantStatus(t, s.do(http.MethodDelete, path, "", "Authorization", auth, "If-Match", s.etag(t, path)), http.StatusNoContent)
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	s := newTestServer(t)
+	_, auth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+	path, tag := s.mustCreateMovie(t, auth)
+
+	for _, header := range []string{tag, "W/" + tag, `"0", ` + tag, "*"} {
+		w := s.do(http.MethodGet, path, "", "If-None-Match", header)
+		wantStatus(t, w, http.StatusNotModified)
+		if w.Body.Len() != 0 {
+			t.Errorf("304 for %s has a body: %s", header, w.Body)
+		}
+		if got := w.Header().Get("ETag"); got != tag {
+			t.Errorf("304 for %s has ETag %s, want %s", header, got, tag)
+		}
+	}
+	wantStatus(t, s.do(http.MethodGet, path, "", "If-None-Match", `"0"`), http.StatusOK)
+}
+
+func TestListETag(t *testing.T) {
+	s := newTestServer(t)
+	_, auth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+	path, tag := s.mustCreateMovie(t, auth)
+
+	list := s.etag(t, "/api/v2/movies")
+	if !strings.HasPrefix(list, `W/"`) {
+		t.Fatalf("list ETag %s is not weak", list)
+	}
+	if again := s.etag(t, "/api/v2/movies"); again != list {
+		t.Errorf("list ETag changed from %s to %s without changes", list, again)
+	}
+	wantStatus(t, s.do(http.MethodGet, "/api/v2/movies", "", "If-None-Match", list), http.StatusNotModified)
+
+	wantStatus(t, s.do(http.MethodPut, path, `{"rating": 8}`, "Authorization", auth, "If-Match", tag), http.StatusOK)
+	if changed := s.etag(t, "/api/v2/movies"); changed == list {
+		t.Errorf("list ETag %s did not change with a movie", list)
+	}
+	wantStatus(t, s.do(http.MethodGet, "/api/v2/movies", "", "If-None-Match", list), http.StatusOK)
+}
+
+// Casts, genres and crews have no versions of their own: changes to them are
+// checked against, and change, the version of the movie.
+func TestIfMatchMovieParts(t *testing.T) {
+	tests := []struct {
+		part, body string
+	}{
+		{"actors", `{"actors": []}`},
+		{"genres", `{"genres": []}`},
+		{"crew", `{"crew": []}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.part, func(t *testing.T) {
+			s := newTestServer(t)
+			_, auth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+			path, tag := s.mustCreateMovie(t, auth)
+			partPath := path + "/" + tt.part
+
+			wantCode(t, s.do(http.MethodPut, partPath, tt.body, "Authorization", auth), http.StatusPreconditionRequired, tools.CodePreconditionRequired)
+
+			w := s.do(http.MethodPut, partPath, tt.body, "Authorization", auth, "If-Match", tag)
+			if w.Code < 200 || w.Code > 299 {
+				t.Fatalf("status = %d, want 2xx; body: %s", w.Code, w.Body)
+			}
+			if s.etag(t, path) == tag {
+				t.Errorf("movie ETag %s did not change with the %s", tag, tt.part)
+			}
+
+			wantCode(t, s.do(http.MethodPut, partPath, tt.body, "Authorization", auth, "If-Match", tag), http.StatusPreconditionFailed, tools.CodePreconditionFailed)
+			wantCode(t, s.do(http.MethodPut, path, `{"rating": 7}`, "Authorization", auth, "If-Match", tag), http.StatusPreconditionFailed, tools.CodePreconditionFailed)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+type GenreRequest struct {
+	Name string `json:"name"`
+}
+
+// MovieGenresRequest lists the genre IDs a movie is tagged with.
+type MovieGenresRequest struct {
+	Genres []int `json:"genres"`
+}
+
+// GetGenres lists every genre with the number of its movies.
+func (h *Handler) GetGenres(w http.ResponseWriter, r *http.Request) {
+
+	genres, err := h.storage.GetGenres(context.Background())
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get genres: %w", err))
+		return
+	}
+
+	writeCacheable(w, r, genres)
+}
+
+func (h *Handler) GetGenre(w http.ResponseWriter, r *http.Request) {
+
+	genreId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Genre ID", http.StatusBadRequest)
+		return
+	}
+
+	genre, err := h.storage.GetGenre(context.Background(), genreId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Genre not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get genre: %w", err))
+		return
+	}
+
+	writeCacheable(w, r, genre)
+}
+
+func (h *Handler) CreateGenre(w http.ResponseWriter, r *http.Request) {
+	var genreBody GenreRequest
+
+	if err := decodeBody(r.Body, &genreBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := genreBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
+	name := strings.TrimSpace(genreBody.Name)
+
+	err := h.storage.CreateGenre(context.Background(), name)
+	if errors.Is(err, storage.ErrGenreExists) {
+		tools.Error(w, tools.CodeConflict, "Genre already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "successfully created",
+	})
+}
+
+// UpdateGenre renames the genre.
+func (h *Handler) UpdateGenre(w http.ResponseWriter, r *http.Request) {
+	genreId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Genre ID", http.StatusBadRequest)
+		return
+	}
+
+	var genreBody GenreRequest
+
+	if err := decodeBody(r.Body, &genreBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := genreBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
+	name := strings.TrimSpace(genreBody.Name)
+
+	err = h.storage.UpdateGenre(context.Background(), genreId, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Genre not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrGenreExists) {
+		tools.Error(w, tools.CodeConflict, "Genre already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "successfully updated",
+	})
+}
+
+// DeleteGenre deletes the genre and untags its movies.
+func (h *Handler) DeleteGenre(w http.ResponseWriter, r *http.Request) {
+	genreId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Genre ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.storage.DeleteGenre(context.Background(), genreId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMovieGenres lists the genres of a movie.
+func (h *Handler) GetMovieGenres(w http.ResponseWriter, r *http.Request) {
+
+	movieId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+		return
+	}
+
+	movie, err := h.storage.GetMovie(context.Background(), movieId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get movie: %w", err))
+		return
+	}
+	if notModified(w, r, etag(movie.Version)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(movie.Genres)
+}
+
+// SetMovieGenres makes the genres of the request body all the genres of the
+// movie and responds with them.
+func (h *Handler) SetMovieGenres(w http.ResponseWriter, r *http.Request) {
+	movieId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+		return
+	}
+
+	var genresBody MovieGenresRequest
+
+	if err := decodeBody(r.Body, &genresBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.SetMovieGenres(context.Background(), movieId, version, genresBody.Genres)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to set genres: %w", err))
+		return
+	}
+
+	h.GetMovieGenres(w, r)
+}
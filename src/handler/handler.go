@@ -3,124 +3,236 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"vktest/src/storage"
+	"vktest/src/tools"
 )
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
-
 type MessageResponse struct {
 	Message string `json:"message"`
 }
 
-type MovieResponse struct {
-	Title        string              `json:"title"`
-	Description  string              `json:"description"`
-	Release_date string              `json:"release_date"`
-	Rating       int                 `json:"rating"`
-	Actors       []storage.ActorName `json:"actors"`
-}
-
 type CreateMovieRequest struct {
-	Title        string `json:"title"`
-	Description  string `json:"description"`
-	Release_date string `json:"release_date"`
-	Rating       int    `json:"rating"`
-	Actors       []int  `json:"actors"`
+	Title        string           `json:"title"`
+	Description  string           `json:"description"`
+	Release_date storage.Date     `json:"release_date"`
+	Rating       int              `json:"rating"`
+	Actors       []storage.Credit `json:"actors"`
+	Genres       []int            `json:"genres"`
 }
 
 type CreateActorRequest struct {
-	Name     string `json:"name"`
-	Gender   string `json:"gender"`
-	Birthday string `json:"birthday"`
+	Name     string       `json:"name"`
+	Gender   string       `json:"gender"`
+	Birthday storage.Date `json:"birthday"`
+}
+
+// CastRequest lists the credits to add to a movie or to replace its cast
+// with. A credit is an actor ID or an object with the actor_id and the part.
+type CastRequest struct {
+	Actors []storage.Credit `json:"actors"`
 }
 
 type UpdateActorRequest struct {
-	ID       int    `json:"id" binding:"required"`
-	Name     string `json:"name"`
-	Gender   string `json:"gender"`
-	Birthday string `json:"birthday"`
+	ID       int          `json:"id"`
+	Name     string       `json:"name"`
+	Gender   string       `json:"gender"`
+	Birthday storage.Date `json:"birthday"`
 }
 
 type UpdateMovieRequest struct {
-	ID           int    `json:"id" binding:"required"`
-	Title        string `json:"title"`
-	Description  string `json:"description"`
-	Release_date string `json:"release_date"`
-	Rating       int    `json:"rating"`
+	ID           int          `json:"id"`
+	Title        string       `json:"title"`
+	Description  string       `json:"description"`
+	Release_date storage.Date `json:"release_date"`
+	Rating       int          `json:"rating"`
+}
+
+// PatchMovieRequest is a JSON merge patch of a movie: absent fields are left
+// as they are and null clears them.
+type PatchMovieRequest storage.MoviePatch
+
+// PatchActorRequest is a JSON merge patch of an actor.
+type PatchActorRequest struct {
+	Name     storage.Optional[string]       `json:"name"`
+	Gender   storage.Optional[string]       `json:"gender"`
+	Birthday storage.Optional[storage.Date] `json:"birthday"`
 }
 
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
 type Handler struct {
 	storage storage.Storage
+	tokens  *tools.Tokens
 }
 
-func NewHandler(storage storage.Storage) *Handler {
-	return &Handler{storage: storage}
+func NewHandler(storage storage.Storage, tokens *tools.Tokens) *Handler {
+	return &Handler{storage: storage, tokens: tokens}
 }
 
 func (h *Handler) GetMovies(w http.ResponseWriter, r *http.Request) {
 
-	sortField := r.URL.Query().Get("sort")
-	if sortField == "" || sortField == "rating" {
-		sortField = "rating DESC"
+	sort := parseSort(r, "-rating")
+
+	page, err := parsePage(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+
+	filter, err := parseMovieFilter(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+
+	movies, err := h.storage.GetMovies(context.Background(), filter, sort, page)
+
+	var sortErr *storage.SortError
+	if errors.As(err, &sortErr) {
+		writeParamError(w, tools.FieldError{Field: "sort", Message: sortErr.Error()})
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get movies: %w", err))
+		return
+	}
+
+	writeCacheable(w, r, movies)
+}
+
+func (h *Handler) GetActors(w http.ResponseWriter, r *http.Request) {
+
+	sort := parseSort(r, "id")
+
+	page, err := parsePage(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+
+	filter, err := parseActorFilter(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+
+	actors, err := h.storage.GetActors(context.Background(), filter, sort, page)
+
+	var sortErr *storage.SortError
+	if errors.As(err, &sortErr) {
+		writeParamError(w, tools.FieldError{Field: "sort", Message: sortErr.Error()})
+		return
 	}
-	if sortField == "title" || sortField == "name" {
-		sortField = "title ASC"
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
-	if sortField == "release_date" || sortField == "release" || sortField == "date" {
-		sortField = "release_date DESC"
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get actors: %w", err))
+		return
 	}
 
-	movies, err := h.storage.GetMovies(context.Background(), sortField)
+	writeCacheable(w, r, actors)
+}
+
+func (h *Handler) GetMovie(w http.ResponseWriter, r *http.Request) {
+
+	movieIdStr := idParam(r)
+	if movieIdStr == "" {
+		tools.Error(w, tools.CodeInvalidParameter, "Movie ID is required", http.StatusBadRequest)
+		return
+	}
 
+	movieId, err := strconv.Atoi(movieIdStr)
 	if err != nil {
-		log.Printf("failed to get movies %s\n", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+		return
+	}
+
+	movie, err := h.storage.GetMovie(context.Background(), movieId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get movie: %w", err))
+		return
+	}
+	if notModified(w, r, etag(movie.Version)) {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(movies)
+	json.NewEncoder(w).Encode(movie)
 }
 
-func (h *Handler) GetActors(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetActor(w http.ResponseWriter, r *http.Request) {
 
-	actors, err := h.storage.GetActors(context.Background())
+	actorIdStr := idParam(r)
+	if actorIdStr == "" {
+		tools.Error(w, tools.CodeInvalidParameter, "Actor ID is required", http.StatusBadRequest)
+		return
+	}
 
+	actorId, err := strconv.Atoi(actorIdStr)
 	if err != nil {
-		log.Printf("failed to get actors %s\n", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Actor ID", http.StatusBadRequest)
+		return
+	}
+
+	actor, err := h.storage.GetActor(context.Background(), actorId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Actor not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get actor: %w", err))
+		return
+	}
+	if notModified(w, r, etag(actor.Version)) {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(actors)
+	json.NewEncoder(w).Encode(actor)
 }
 
 func (h *Handler) CreateActor(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "error: Only POST method is allowed", http.StatusMethodNotAllowed)
+		tools.Error(w, tools.CodeMethodNotAllowed, "Only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var actorBody CreateActorRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&actorBody); err != nil {
-		http.Error(w, "error: Invalid request body", http.StatusBadRequest)
+	if err := decodeBody(r.Body, &actorBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := actorBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
 		return
 	}
 
 	err := h.storage.CreateActor(context.Background(), actorBody.Name, actorBody.Gender, actorBody.Birthday)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -133,20 +245,25 @@ func (h *Handler) CreateActor(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) CreateMovie(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "error: Only POST method is allowed", http.StatusMethodNotAllowed)
+		tools.Error(w, tools.CodeMethodNotAllowed, "Only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var movieBody CreateMovieRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&movieBody); err != nil {
-		http.Error(w, "error: Invalid request body", http.StatusBadRequest)
+	if err := decodeBody(r.Body, &movieBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := movieBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
 		return
 	}
 
-	err := h.storage.CreateMovie(context.Background(), movieBody.Title, movieBody.Description, movieBody.Release_date, movieBody.Rating, movieBody.Actors)
+	err := h.storage.CreateMovie(context.Background(), movieBody.Title, movieBody.Description, movieBody.Release_date, movieBody.Rating, movieBody.Actors, movieBody.Genres)
+
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -159,82 +276,103 @@ func (h *Handler) CreateMovie(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) DeleteActor(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "error: Only DELETE method is allowed", http.StatusMethodNotAllowed)
+		tools.Error(w, tools.CodeMethodNotAllowed, "Only DELETE method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	actorIdStr := r.URL.Query().Get("id")
+	actorIdStr := idParam(r)
 	if actorIdStr == "" {
-		http.Error(w, "error: Actor ID is required", http.StatusBadRequest)
+		tools.Error(w, tools.CodeInvalidParameter, "Actor ID is required", http.StatusBadRequest)
 		return
 	}
 
 	actorId, err := strconv.Atoi(actorIdStr)
 	if err != nil {
-		http.Error(w, "error: Invalid Actor ID", http.StatusBadRequest)
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Actor ID", http.StatusBadRequest)
 		return
 	}
 
-	err = h.storage.DeleteActor(context.Background(), actorId)
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.DeleteActor(context.Background(), actorId, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent)
-	json.NewEncoder(w).Encode(MessageResponse{
-		Message: "successfully deleted",
-	})
 }
 
 func (h *Handler) DeleteMovie(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "error: Only DELETE method is allowed", http.StatusMethodNotAllowed)
+		tools.Error(w, tools.CodeMethodNotAllowed, "Only DELETE method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	movieIdStr := r.URL.Query().Get("id")
+	movieIdStr := idParam(r)
 	if movieIdStr == "" {
-		http.Error(w, "error: Actor ID is required", http.StatusBadRequest)
+		tools.Error(w, tools.CodeInvalidParameter, "Movie ID is required", http.StatusBadRequest)
 		return
 	}
 
 	movieId, err := strconv.Atoi(movieIdStr)
 	if err != nil {
-		http.Error(w, "error: Invalid Actor ID", http.StatusBadRequest)
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
 		return
 	}
 
-	err = h.storage.DeleteMovie(context.Background(), movieId)
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.DeleteMovie(context.Background(), movieId, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent)
-	json.NewEncoder(w).Encode(MessageResponse{
-		Message: "successfully deleted",
-	})
 }
 
 func (h *Handler) UpdateActor(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "error: Only PUT method is allowed", http.StatusMethodNotAllowed)
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		tools.Error(w, tools.CodeMethodNotAllowed, "Only PUT and PATCH methods are allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var actorBody UpdateActorRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&actorBody); err != nil {
-		http.Error(w, "error: Invalid request body", http.StatusBadRequest)
+	if err := decodeBody(r.Body, &actorBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	// On /api/v2 the ID is part of the path and wins over the body.
+	if idStr := r.PathValue("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			tools.Error(w, tools.CodeInvalidParameter, "Invalid Actor ID", http.StatusBadRequest)
+			return
+		}
+		actorBody.ID = id
+	}
+	if errs := actorBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
 		return
 	}
 
-	err := h.storage.UpdateActor(context.Background(), actorBody.ID, actorBody.Name, actorBody.Gender, actorBody.Birthday)
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.storage.UpdateActor(context.Background(), actorBody.ID, version, actorBody.Name, actorBody.Gender, actorBody.Birthday)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -246,21 +384,40 @@ func (h *Handler) UpdateActor(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) UpdateMovie(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "error: Only PUT method is allowed", http.StatusMethodNotAllowed)
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		tools.Error(w, tools.CodeMethodNotAllowed, "Only PUT and PATCH methods are allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var movieBody UpdateMovieRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&movieBody); err != nil {
-		http.Error(w, "error: Invalid request body", http.StatusBadRequest)
+	if err := decodeBody(r.Body, &movieBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	// On /api/v2 the ID is part of the path and wins over the body.
+	if idStr := r.PathValue("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+			return
+		}
+		movieBody.ID = id
+	}
+	if errs := movieBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
 		return
 	}
 
-	err := h.storage.UpdateMovie(context.Background(), movieBody.ID, movieBody.Title, movieBody.Description, movieBody.Release_date, movieBody.Rating)
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.storage.UpdateMovie(context.Background(), movieBody.ID, version, movieBody.Title, movieBody.Description, movieBody.Release_date, movieBody.Rating)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -271,69 +428,378 @@ func (h *Handler) UpdateMovie(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *Handler) SearchMovies(w http.ResponseWriter, r *http.Request) {
+// PatchMovie applies a JSON merge patch (RFC 7396) to the movie and responds
+// with the result.
+func (h *Handler) PatchMovie(w http.ResponseWriter, r *http.Request) {
+	movieId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+		return
+	}
 
-	search := r.URL.Query().Get("search")
+	var patch PatchMovieRequest
 
-	sortField := r.URL.Query().Get("sort")
-	if sortField == "" || sortField == "rating" {
-		sortField = "rating DESC"
+	if !checkMergePatch(w, r) {
+		return
 	}
-	if sortField == "title" || sortField == "name" {
-		sortField = "title ASC"
+	if err := decodeBody(r.Body, &patch); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := patch.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.PatchMovie(context.Background(), movieId, version, storage.MoviePatch(patch))
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Movie not found", http.StatusNotFound)
+		return
 	}
-	if sortField == "release_date" || sortField == "release" || sortField == "date" {
-		sortField = "release_date DESC"
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to patch movie: %w", err))
+		return
 	}
 
-	movies, err := h.storage.GetMovies(context.Background(), sortField)
+	h.GetMovie(w, r)
+}
+
+// PatchActor applies a JSON merge patch (RFC 7396) to the actor and responds
+// with the result.
+func (h *Handler) PatchActor(w http.ResponseWriter, r *http.Request) {
+	actorId, err := strconv.Atoi(idParam(r))
 	if err != nil {
-		log.Printf("failed to get movies %s\n", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Actor ID", http.StatusBadRequest)
 		return
 	}
 
-	var acceptMovies []storage.MovieInfo
+	var patch PatchActorRequest
 
-	for _, v := range movies {
-		checkActorName := false
-		for _, val := range v.Actors {
-			if strings.Contains(val.Name, search) {
-				checkActorName = true
-				break
-			}
-		}
+	if !checkMergePatch(w, r) {
+		return
+	}
+	if err := decodeBody(r.Body, &patch); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := patch.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
 
-		if strings.Contains(v.Title, search) || checkActorName {
-			acceptMovies = append(acceptMovies, v)
-		}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.PatchPerson(context.Background(), actorId, version, storage.PersonPatch{
+		Name:     patch.Name,
+		Gender:   patch.Gender,
+		Birthday: patch.Birthday,
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Actor not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to patch actor: %w", err))
+		return
+	}
+
+	h.GetActor(w, r)
+}
+
+// GetMovieActors lists the cast of a movie.
+func (h *Handler) GetMovieActors(w http.ResponseWriter, r *http.Request) {
+
+	movieId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+		return
+	}
+
+	movie, err := h.storage.GetMovie(context.Background(), movieId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get movie: %w", err))
+		return
+	}
+	if notModified(w, r, etag(movie.Version)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(movie.Actors)
+}
+
+// AddMovieActors links the actors of the request body to the movie. Actors
+// that are already linked are left as they are.
+func (h *Handler) AddMovieActors(w http.ResponseWriter, r *http.Request) {
+	var castBody CastRequest
+
+	if err := decodeBody(r.Body, &castBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := castBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
+
+	h.changeCast(w, r, func(ctx context.Context, movieId, version int) error {
+		return h.storage.AddMovieActors(ctx, movieId, version, castBody.Actors)
+	})
+}
+
+// ReplaceMovieActors makes the actors of the request body the whole cast.
+func (h *Handler) ReplaceMovieActors(w http.ResponseWriter, r *http.Request) {
+	var castBody CastRequest
+
+	if err := decodeBody(r.Body, &castBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := castBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
+
+	h.changeCast(w, r, func(ctx context.Context, movieId, version int) error {
+		return h.storage.ReplaceMovieActors(ctx, movieId, version, castBody.Actors)
+	})
+}
+
+// AddMovieActor links the {actor_id} of the path to the movie. The optional
+// body sets the part, replacing the one of an existing link.
+func (h *Handler) AddMovieActor(w http.ResponseWriter, r *http.Request) {
+	actorId, err := strconv.Atoi(r.PathValue("actor_id"))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Actor ID", http.StatusBadRequest)
+		return
+	}
+
+	credit := storage.Credit{ActorID: actorId}
+	if err := decodeBody(r.Body, &credit.Part); err != nil && !errors.Is(err, io.EOF) {
+		writeBodyError(w, err)
+		return
+	}
+
+	h.changeCast(w, r, func(ctx context.Context, movieId, version int) error {
+		return h.storage.AddMovieActors(ctx, movieId, version, []storage.Credit{credit})
+	})
+}
+
+// RemoveMovieActor unlinks the {actor_id} of the path from the movie. It
+// succeeds when the actor was not linked.
+func (h *Handler) RemoveMovieActor(w http.ResponseWriter, r *http.Request) {
+	actorId, err := strconv.Atoi(r.PathValue("actor_id"))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Actor ID", http.StatusBadRequest)
+		return
+	}
+
+	h.changeCast(w, r, func(ctx context.Context, movieId, version int) error {
+		return h.storage.RemoveMovieActors(ctx, movieId, version, []int{actorId})
+	})
+}
+
+// changeCast applies change to the cast of the movie in the path, at the
+// version of If-Match, and responds with the resulting cast.
+func (h *Handler) changeCast(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, movieId, version int) error) {
+	movieId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = change(context.Background(), movieId, version)
+
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to change cast: %w", err))
+		return
+	}
+
+	h.GetMovieActors(w, r)
+}
+
+// GetActorMovies lists the movies of an actor.
+func (h *Handler) GetActorMovies(w http.ResponseWriter, r *http.Request) {
+
+	actorId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Actor ID", http.StatusBadRequest)
+		return
+	}
+
+	actor, err := h.storage.GetActor(context.Background(), actorId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Actor not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get actor: %w", err))
+		return
+	}
+	if notModified(w, r, etag(actor.Version)) {
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(acceptMovies)
+	json.NewEncoder(w).Encode(actor.Movies)
 }
 
-// func MovieToResponse(movie storage.MovieInfo) MovieResponse {
-// 	return MovieResponse{
-// 		Title:        movie.Title,
-// 		Description:  movie.Description,
-// 		Release_date: movie.Release_date,
-// 		Rating:       movie.Rating,
-// 		Actors:       movie.Actors,
-// 	}
-// }
+func (h *Handler) SearchMovies(w http.ResponseWriter, r *http.Request) {
 
-// func MoviesToResponse(movies []storage.MovieInfo) []MovieResponse {
-// 	if movies == nil {
-// 		return nil
-// 	}
+	search := r.URL.Query().Get("search")
+	if strings.TrimSpace(search) == "" {
+		tools.Error(w, tools.CodeInvalidParameter, "Search query is required", http.StatusBadRequest)
+		return
+	}
 
-// 	res := make([]MovieResponse, len(movies))
+	sort := parseSort(r, "-relevance")
 
-// 	for index, value := range movies {
-// 		res[index] = MovieToResponse(value)
-// 	}
+	page, err := parsePage(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
 
-// 	return res
-// }
+	filter, err := parseMovieFilter(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+
+	movies, err := h.storage.SearchMovies(context.Background(), search, filter, sort, page)
+
+	var sortErr *storage.SortError
+	if errors.As(err, &sortErr) {
+		writeParamError(w, tools.FieldError{Field: "sort", Message: sortErr.Error()})
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		tools.Error(w, tools.CodeInvalidParameter, "Search is paged by limit and offset only", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to search movies: %w", err))
+		return
+	}
+
+	writeCacheable(w, r, movies)
+}
+
+// idParam returns the {id} path value of an /api/v2 route, or the id query
+// parameter of its /api/v1 alias.
+func idParam(r *http.Request) string {
+	if id := r.PathValue("id"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("id")
+}
+
+// parseSort reads the sort query parameter, e.g. "-rating,title". def is used
+// when the parameter is absent.
+func parseSort(r *http.Request, def string) []storage.SortKey {
+	expr := r.URL.Query().Get("sort")
+	if expr == "" {
+		expr = def
+	}
+	return storage.ParseSort(expr)
+}
+
+// parsePage reads limit/offset and the after/before cursors from the query
+// string. Without a limit the first defaultPageLimit rows are returned.
+func parsePage(r *http.Request) (storage.Page, error) {
+	query := r.URL.Query()
+	page := storage.Page{
+		Limit:  defaultPageLimit,
+		After:  query.Get("after"),
+		Before: query.Get("before"),
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, tools.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", maxPageLimit)}
+		}
+		page.Limit = limit
+	}
+
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return page, tools.FieldError{Field: "offset", Message: "must be a non-negative integer"}
+		}
+		page.Offset = offset
+	}
+
+	if page.After != "" && page.Before != "" {
+		return page, tools.FieldError{Field: "before", Message: "must not be set along with after"}
+	}
+
+	return page, nil
+}
+
+// parseMovieFilter reads the released_after/released_before bounds, ISO-8601
+// dates that may omit the day or the month, and the genre names, e.g.
+// genre=drama,thriller. genre_match=all keeps the movies in every named genre
+// instead of in any of them.
+func parseMovieFilter(r *http.Request) (storage.MovieFilter, error) {
+	var filter storage.MovieFilter
+	var err error
+
+	query := r.URL.Query()
+	if filter.ReleasedAfter, err = storage.ParseDate(query.Get("released_after")); err != nil {
+		return filter, tools.FieldError{Field: "released_after", Message: err.Error()}
+	}
+	if filter.ReleasedBefore, err = storage.ParseDate(query.Get("released_before")); err != nil {
+		return filter, tools.FieldError{Field: "released_before", Message: err.Error()}
+	}
+
+	for _, genres := range query["genre"] {
+		filter.Genres = append(filter.Genres, strings.Split(genres, ",")...)
+	}
+	switch query.Get("genre_match") {
+	case "", "any":
+	case "all":
+		filter.AllGenres = true
+	default:
+		return filter, tools.FieldError{Field: "genre_match", Message: "must be any or all"}
+	}
+	return filter, nil
+}
+
+// parseActorFilter reads the born_after/born_before bounds.
+func parseActorFilter(r *http.Request) (storage.ActorFilter, error) {
+	var filter storage.ActorFilter
+	var err error
+
+	query := r.URL.Query()
+	if filter.BornAfter, err = storage.ParseDate(query.Get("born_after")); err != nil {
+		return filter, tools.FieldError{Field: "born_after", Message: err.Error()}
+	}
+	if filter.BornBefore, err = storage.ParseDate(query.Get("born_before")); err != nil {
+		return filter, tools.FieldError{Field: "born_before", Message: err.Error()}
+	}
+	return filter, nil
+}
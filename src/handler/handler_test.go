@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+const testPassword = "correct horse battery"
+
+// testServer serves the /api/v2 routes that the tests use, wired as in main,
+// on the in-memory storage.
+type testServer struct {
+	store storage.Storage
+	mux   *http.ServeMux
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	store := storage.NewMemStorage()
+	key := tools.SigningKey{ID: "test", Secret: []byte("test-secret-test-secret-test-sec")}
+	tokens := tools.NewTokens(store, []tools.SigningKey{key})
+	auth := tools.NewAuth(store, store, tokens)
+	h := NewHandler(store, tokens)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermRead, h.GetMovies))
+	mux.HandleFunc("POST /api/v2/movies", auth.Require(tools.ResourceMovies, tools.PermEdit, h.CreateMovie))
+	mux.HandleFunc("GET /api/v2/movies/{id}", auth.Require(tools.ResourceMovies, tools.PermRead, h.GetMovie))
+	mux.HandleFunc("PUT /api/v2/movies/{id}", auth.Require(tools.ResourceMovies, tools.PermEdit, h.UpdateMovie))
+	mux.HandleFunc("PATCH /api/v2/movies/{id}", auth.Require(tools.ResourceMovies, tools.PermEdit, h.PatchMovie))
+	mux.HandleFunc("DELETE /api/v2/movies/{id}", auth.Require(tools.ResourceMovies, tools.PermDelete, h.DeleteMovie))
+	mux.HandleFunc("PUT /api/v2/movies/{id}/actors", auth.Require(tools.ResourceMovies, tools.PermEdit, h.ReplaceMovieActors))
+	mux.HandleFunc("PUT /api/v2/movies/{id}/genres", auth.Require(tools.ResourceMovies, tools.PermEdit, h.SetMovieGenres))
+	mux.HandleFunc("PUT /api/v2/movies/{id}/crew", auth.Require(tools.ResourceMovies, tools.PermEdit, h.ReplaceMovieCrew))
+	mux.HandleFunc("GET /api/v2/actors", auth.Require(tools.ResourceActors, tools.PermRead, h.GetActors))
+	mux.HandleFunc("POST /api/v2/actors", auth.Require(tools.ResourceActors, tools.PermEdit, h.CreateActor))
+	mux.HandleFunc("GET /api/v2/users", auth.Require(tools.ResourceUsers, tools.PermManageUsers, h.GetUsers))
+	mux.HandleFunc("PUT /api/v2/users/{id}/password", auth.Require(tools.ResourceUsers, tools.PermAccount, h.ChangePassword))
+	mux.HandleFunc("GET /api/v2/api-keys", auth.Require(tools.ResourceUsers, tools.PermManageKeys, h.GetAPIKeys))
+	mux.HandleFunc("POST /api/v2/api-keys", auth.Require(tools.ResourceUsers, tools.PermManageKeys, h.CreateAPIKey))
+	mux.HandleFunc("DELETE /api/v2/api-keys/{id}", auth.Require(tools.ResourceUsers, tools.PermManageKeys, h.DeleteAPIKey))
+
+	return &testServer{store: store, mux: mux}
+}
+
+// do sends a request with the body, if any, and the header given as
+// name/value pairs.
+func (s *testServer) do(method, path, body string, header ...string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, path, nil)
+	} else {
+		r = httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, r)
+	return w
+}
+
+// mustCreateUser creates a user with testPassword and returns the value of
+// its basic auth header.
+func (s *testServer) mustCreateUser(t *testing.T, username string, role storage.UserRole) (storage.User, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	hash, err := storage.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if err := s.store.CreateUser(ctx, username, hash, role); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := s.store.GetUserByName(ctx, username)
+	if err != nil {
+		t.Fatalf("GetUserByName: %v", err)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth(username, testPassword)
+	return user, r.Header.Get("Authorization")
+}
+
+// wantStatus fails the test unless the response has the status.
+func wantStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, status, w.Body)
+	}
+}
+
+// wantCode fails the test unless the response is a problem with the status
+// and code.
+func wantCode(t *testing.T, w *httptest.ResponseRecorder, status int, code tools.ErrorCode) {
+	t.Helper()
+	wantStatus(t, w, status)
+	if p := decodeProblem(t, w); p.Code != code {
+		t.Errorf("code = %q, want %q", p.Code, code)
+	}
+}
+
+// decodeProblem decodes a problem details response.
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) tools.Problem {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want application/problem+json", ct)
+	}
+	var p tools.Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	return p
+}
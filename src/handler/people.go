@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+// CreatePersonRequest is CreateActorRequest for anyone who worked on a movie.
+// KnownFor is required; people known for acting are listed among the actors.
+type CreatePersonRequest struct {
+	Name     string             `json:"name"`
+	Gender   string             `json:"gender"`
+	Birthday storage.Date       `json:"birthday"`
+	KnownFor storage.Department `json:"known_for"`
+}
+
+type UpdatePersonRequest struct {
+	Name     string             `json:"name"`
+	Gender   string             `json:"gender"`
+	Birthday storage.Date       `json:"birthday"`
+	KnownFor storage.Department `json:"known_for"`
+}
+
+// PatchPersonRequest is a JSON merge patch of a person.
+type PatchPersonRequest storage.PersonPatch
+
+// CrewRequest lists the crew credits to replace the crew of a movie with.
+type CrewRequest struct {
+	Crew []storage.CrewCredit `json:"crew"`
+}
+
+func (h *Handler) CreatePerson(w http.ResponseWriter, r *http.Request) {
+	var personBody CreatePersonRequest
+
+	if err := decodeBody(r.Body, &personBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := personBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
+
+	err := h.storage.CreatePerson(context.Background(), personBody.Name, personBody.Gender, personBody.Birthday, personBody.KnownFor)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "successfully created",
+	})
+}
+
+// GetPerson responds with the person and their filmography grouped by
+// department.
+func (h *Handler) GetPerson(w http.ResponseWriter, r *http.Request) {
+	person, ok := h.getPerson(w, r)
+	if !ok || notModified(w, r, etag(person.Version)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(person)
+}
+
+// GetPersonFilmography lists the movies of the person grouped by department,
+// newest first in each.
+func (h *Handler) GetPersonFilmography(w http.ResponseWriter, r *http.Request) {
+	person, ok := h.getPerson(w, r)
+	if !ok || notModified(w, r, etag(person.Version)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(person.Filmography)
+}
+
+// getPerson loads the person of the {id} path value. On failure it writes
+// the error response and reports false.
+func (h *Handler) getPerson(w http.ResponseWriter, r *http.Request) (storage.PersonInfo, bool) {
+	personId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Person ID", http.StatusBadRequest)
+		return storage.PersonInfo{}, false
+	}
+
+	person, err := h.storage.GetPerson(context.Background(), personId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Person not found", http.StatusNotFound)
+		return person, false
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get person: %w", err))
+		return person, false
+	}
+	return person, true
+}
+
+func (h *Handler) UpdatePerson(w http.ResponseWriter, r *http.Request) {
+	personId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Person ID", http.StatusBadRequest)
+		return
+	}
+
+	var personBody UpdatePersonRequest
+
+	if err := decodeBody(r.Body, &personBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := personBody.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.UpdatePerson(context.Background(), personId, version, personBody.Name, personBody.Gender, personBody.Birthday, personBody.KnownFor)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "successfully updated",
+	})
+}
+
+// PatchPerson applies a JSON merge patch (RFC 7396) to the person and
+// responds with the result.
+func (h *Handler) PatchPerson(w http.ResponseWriter, r *http.Request) {
+	personId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Person ID", http.StatusBadRequest)
+		return
+	}
+
+	var patch PatchPersonRequest
+
+	if !checkMergePatch(w, r) {
+		return
+	}
+	if err := decodeBody(r.Body, &patch); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if errs := patch.validate(); len(errs) > 0 {
+		writeFieldErrors(w, errs...)
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.PatchPerson(context.Background(), personId, version, storage.PersonPatch(patch))
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Person not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to patch person: %w", err))
+		return
+	}
+
+	h.GetPerson(w, r)
+}
+
+// DeletePerson deletes the person with all their cast and crew credits.
+func (h *Handler) DeletePerson(w http.ResponseWriter, r *http.Request) {
+	personId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Person ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.DeletePerson(context.Background(), personId, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMovieCrew lists the crew of a movie by department.
+func (h *Handler) GetMovieCrew(w http.ResponseWriter, r *http.Request) {
+
+	movieId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+		return
+	}
+
+	movie, err := h.storage.GetMovie(context.Background(), movieId)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get movie: %w", err))
+		return
+	}
+	if notModified(w, r, etag(movie.Version)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(movie.Crew)
+}
+
+// ReplaceMovieCrew makes the credits of the request body the whole crew of
+// the movie and responds with it.
+func (h *Handler) ReplaceMovieCrew(w http.ResponseWriter, r *http.Request) {
+	movieId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid Movie ID", http.StatusBadRequest)
+		return
+	}
+
+	var crewBody CrewRequest
+
+	if err := decodeBody(r.Body, &crewBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.storage.ReplaceMovieCrew(context.Background(), movieId, version, crewBody.Crew)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to replace crew: %w", err))
+		return
+	}
+
+	h.GetMovieCrew(w, r)
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+// CreateUserRequest creates a viewer unless Role says otherwise.
+type CreateUserRequest struct {
+	Username string           `json:"username"`
+	Password string           `json:"password"`
+	Role     storage.UserRole `json:"role"`
+}
+
+type PasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// UserStatusRequest disables or re-enables an account.
+type UserStatusRequest struct {
+	Disabled bool `json:"disabled"`
+}
+
+type UserRoleRequest struct {
+	Role storage.UserRole `json:"role"`
+}
+
+// GetUsers lists every account, without the password hashes.
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+
+	users, err := h.storage.GetUsers(context.Background())
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to get users: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(users)
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var userBody CreateUserRequest
+
+	if err := decodeBody(r.Body, &userBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	username := strings.TrimSpace(userBody.Username)
+	if username == "" || len(username) > 80 {
+		writeFieldErrors(w, tools.FieldError{Field: "username", Message: "must be 1 to 80 characters long"})
+		return
+	}
+	if userBody.Role == "" {
+		userBody.Role = storage.UserRoleViewer
+	}
+	hash, ok := hashPassword(w, userBody.Password)
+	if !ok {
+		return
+	}
+
+	err := h.storage.CreateUser(context.Background(), username, hash, userBody.Role)
+	if errors.Is(err, storage.ErrUserExists) {
+		tools.Error(w, tools.CodeConflict, "User already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "successfully created",
+	})
+}
+
+// ChangePassword sets a new password for the user. Users may change their
+// own password; only user managers may change the others'.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid User ID", http.StatusBadRequest)
+		return
+	}
+	current, _ := tools.UserFromContext(r.Context())
+	if current.ID != userId && !tools.Allowed(current.Role, tools.PermManageUsers) {
+		tools.Error(w, tools.CodeForbidden, "Only admins may change the passwords of others", http.StatusForbidden)
+		return
+	}
+
+	var passwordBody PasswordRequest
+
+	if err := decodeBody(r.Body, &passwordBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	hash, ok := hashPassword(w, passwordBody.Password)
+	if !ok {
+		return
+	}
+
+	err = h.storage.SetUserPassword(context.Background(), userId, hash)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "successfully updated",
+	})
+}
+
+// SetUserStatus disables or re-enables the account. Users cannot disable
+// themselves, so there is always someone left to undo it.
+func (h *Handler) SetUserStatus(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid User ID", http.StatusBadRequest)
+		return
+	}
+
+	var statusBody UserStatusRequest
+
+	if err := decodeBody(r.Body, &statusBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if current, ok := tools.UserFromContext(r.Context()); ok && current.ID == userId && statusBody.Disabled {
+		tools.Error(w, tools.CodeConflict, "You cannot disable your own account", http.StatusConflict)
+		return
+	}
+
+	err = h.storage.SetUserDisabled(context.Background(), userId, statusBody.Disabled)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "successfully updated",
+	})
+}
+
+// SetUserRole changes the role of the account. Users cannot change their own
+// role, so an admin cannot lock everyone out of user management.
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		tools.Error(w, tools.CodeInvalidParameter, "Invalid User ID", http.StatusBadRequest)
+		return
+	}
+
+	var roleBody UserRoleRequest
+
+	if err := decodeBody(r.Body, &roleBody); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if roleBody.Role == "" {
+		writeFieldErrors(w, tools.FieldError{Field: "role", Message: "is required"})
+		return
+	}
+	if current, ok := tools.UserFromContext(r.Context()); ok && current.ID == userId {
+		tools.Error(w, tools.CodeConflict, "You cannot change your own role", http.StatusConflict)
+		return
+	}
+
+	err = h.storage.SetUserRole(context.Background(), userId, roleBody.Role)
+	if errors.Is(err, storage.ErrNotFound) {
+		tools.Error(w, tools.CodeNotFound, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "successfully updated",
+	})
+}
+
+// hashPassword checks the length of the password and hashes it. On failure
+// it writes the error response and reports false.
+func hashPassword(w http.ResponseWriter, password string) ([]byte, bool) {
+	if !storage.ValidPassword(password) {
+		writeFieldErrors(w, tools.FieldError{
+			Field:   "password",
+			Message: fmt.Sprintf("must be %d to %d bytes long", storage.MinPasswordLength, storage.MaxPasswordLength),
+		})
+		return nil, false
+	}
+
+	hash, err := storage.HashPassword(password)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	return hash, true
+}
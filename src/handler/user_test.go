@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	alice, aliceAuth := s.mustCreateUser(t, "alice", storage.UserRoleViewer)
+	bob, bobAuth := s.mustCreateUser(t, "bob", storage.UserRoleEditor)
+	_, adminAuth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+
+	signsIn := func(username, password string) bool {
+		t.Helper()
+		_, ok, err := tools.Authenticate(context.Background(), s.store, username, password)
+		if err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+		return ok
+	}
+	path := func(user storage.User) string { return fmt.Sprintf("/api/v2/users/%d/password", user.ID) }
+
+	t.Run("own", func(t *testing.T) {
+		w := s.do(http.MethodPut, path(alice), `{"password": "alice's new password"}`, "Authorization", aliceAuth)
+		wantStatus(t, w, http.StatusOK)
+		if !signsIn("alice", "alice's new password") {
+			t.Error("alice cannot sign in with the new password")
+		}
+	})
+
+	t.Run("others", func(t *testing.T) {
+		w := s.do(http.MethodPut, path(alice), `{"password": "bob's password for alice"}`, "Authorization", bobAuth)
+		wantStatus(t, w, http.StatusForbidden)
+		if p := decodeProblem(t, w); p.Code != tools.CodeForbidden {
+			t.Errorf("code = %q, want %q", p.Code, tools.CodeForbidden)
+		}
+		if signsIn("alice", "bob's password for alice") {
+			t.Error("bob changed alice's password")
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		w := s.do(http.MethodPut, path(bob), `{"password": "admin's password for bob"}`, "Authorization", adminAuth)
+		wantStatus(t, w, http.StatusOK)
+		if !signsIn("bob", "admin's password for bob") {
+			t.Error("bob cannot sign in with the password the admin set")
+		}
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		w := s.do(http.MethodPut, path(alice), `{"password": "anonymous password"}`)
+		wantStatus(t, w, http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+// The limits of the columns behind the request bodies.
+const (
+	maxTitleLength       = 150
+	maxDescriptionLength = 1000
+	maxNameLength        = 80
+	maxGenderLength      = 30
+	maxGenreNameLength   = 50
+	maxCharacterLength   = 150
+	minRating            = 0
+	maxRating            = 10
+)
+
+// errTrailingData is the error of decodeBody for bodies with more than one
+// JSON value.
+var errTrailingData = errors.New("unexpected data after the JSON value")
+
+// decodeBody decodes the JSON request body into v. Fields that v does not
+// have are an error, so that typos are not silently ignored, and so is
+// anything after the value. An empty body is io.EOF.
+func decodeBody(body io.Reader, v any) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if err := decoder.Decode(&json.RawMessage{}); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// unknownField returns the name of the field of an error of decodeBody about
+// a field that is not known. encoding/json has no error type for it.
+func unknownField(err error) (string, bool) {
+	field, ok := strings.CutPrefix(err.Error(), `json: unknown field "`)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSuffix(field, `"`), true
+}
+
+// checkMergePatch checks that the body of a PATCH request is a JSON merge
+// patch. Plain JSON is accepted too. On failure it writes the error response
+// and reports false.
+func checkMergePatch(w http.ResponseWriter, r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/merge-patch+json" || mediaType == "application/json") {
+		return true
+	}
+	w.Header().Set("Accept-Patch", "application/merge-patch+json")
+	tools.Error(w, tools.CodeUnsupportedMediaType, "The body must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+	return false
+}
+
+// validator collects the field errors of a request body, so that all of them
+// are reported at once.
+type validator struct {
+	errs []tools.FieldError
+}
+
+func (v *validator) check(ok bool, field, message string) {
+	if !ok {
+		v.errs = append(v.errs, tools.FieldError{Field: field, Message: message})
+	}
+}
+
+func (v *validator) required(field, value string) {
+	v.check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// maxLength checks the length in characters, as the columns count it.
+func (v *validator) maxLength(field, value string, max int) {
+	v.check(utf8.RuneCountInString(value) <= max, field, fmt.Sprintf("must be at most %d characters long", max))
+}
+
+func (v *validator) rating(field string, rating int) {
+	v.check(rating >= minRating && rating <= maxRating, field, fmt.Sprintf("must be between %d and %d", minRating, maxRating))
+}
+
+func (v *validator) credits(field string, credits []storage.Credit) {
+	for i, credit := range credits {
+		v.check(credit.ActorID > 0, fmt.Sprintf("%s[%d].actor_id", field, i), "is required")
+		v.part(fmt.Sprintf("%s[%d]", field, i), credit.Part)
+	}
+}
+
+func (v *validator) part(field string, part storage.Part) {
+	v.maxLength(field+".character", part.Character, maxCharacterLength)
+	v.check(part.Billing >= 0, field+".billing", "must not be negative")
+}
+
+func (req CreateMovieRequest) validate() []tools.FieldError {
+	var v validator
+	v.required("title", req.Title)
+	v.maxLength("title", req.Title, maxTitleLength)
+	v.maxLength("description", req.Description, maxDescriptionLength)
+	v.rating("rating", req.Rating)
+	v.credits("actors", req.Actors)
+	return v.errs
+}
+
+// validate checks the fields that are set; the others are left as they are.
+func (req UpdateMovieRequest) validate() []tools.FieldError {
+	var v validator
+	v.check(req.ID > 0, "id", "is required")
+	v.maxLength("title", req.Title, maxTitleLength)
+	v.maxLength("description", req.Description, maxDescriptionLength)
+	v.rating("rating", req.Rating)
+	return v.errs
+}
+
+func (req CreateActorRequest) validate() []tools.FieldError {
+	var v validator
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	v.maxLength("gender", req.Gender, maxGenderLength)
+	return v.errs
+}
+
+// validate checks the fields that are set; the others are left as they are.
+func (req UpdateActorRequest) validate() []tools.FieldError {
+	var v validator
+	v.check(req.ID > 0, "id", "is required")
+	v.maxLength("name", req.Name, maxNameLength)
+	v.maxLength("gender", req.Gender, maxGenderLength)
+	return v.errs
+}
+
+func (req CreatePersonRequest) validate() []tools.FieldError {
+	var v validator
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	v.maxLength("gender", req.Gender, maxGenderLength)
+	v.check(req.KnownFor != "", "known_for", "is required")
+	return v.errs
+}
+
+// validate checks the fields that are set; the others are left as they are.
+func (req UpdatePersonRequest) validate() []tools.FieldError {
+	var v validator
+	v.maxLength("name", req.Name, maxNameLength)
+	v.maxLength("gender", req.Gender, maxGenderLength)
+	return v.errs
+}
+
+func (req CastRequest) validate() []tools.FieldError {
+	var v validator
+	v.credits("actors", req.Actors)
+	return v.errs
+}
+
+func (req GenreRequest) validate() []tools.FieldError {
+	var v validator
+	v.required("name", req.Name)
+	v.maxLength("name", strings.TrimSpace(req.Name), maxGenreNameLength)
+	return v.errs
+}
+
+// validate checks the fields that the patch sets. Null clears a field, which
+// the required ones do not allow.
+func (req PatchMovieRequest) validate() []tools.FieldError {
+	var v validator
+	if req.Title.Set {
+		v.required("title", req.Title.Value)
+		v.maxLength("title", req.Title.Value, maxTitleLength)
+	}
+	if req.Description.Set {
+		v.maxLength("description", req.Description.Value, maxDescriptionLength)
+	}
+	if req.Rating.Set {
+		v.rating("rating", req.Rating.Value)
+	}
+	return v.errs
+}
+
+func (req PatchActorRequest) validate() []tools.FieldError {
+	var v validator
+	if req.Name.Set {
+		v.required("name", req.Name.Value)
+		v.maxLength("name", req.Name.Value, maxNameLength)
+	}
+	if req.Gender.Set {
+		v.maxLength("gender", req.Gender.Value, maxGenderLength)
+	}
+	return v.errs
+}
+
+func (req PatchPersonRequest) validate() []tools.FieldError {
+	var v validator
+	if req.Name.Set {
+		v.required("name", req.Name.Value)
+		v.maxLength("name", req.Name.Value, maxNameLength)
+	}
+	if req.Gender.Set {
+		v.maxLength("gender", req.Gender.Value, maxGenderLength)
+	}
+	if req.KnownFor.Set {
+		v.check(req.KnownFor.Value != "", "known_for", "is required")
+	}
+	return v.errs
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		body string
+		want error
+	}{
+		{`{"title": "Alien"}`, nil},
+		{"{\"title\": \"Alien\"}\n  \n", nil},
+		{"", io.EOF},
+		{`{"title": "Alien"} {"title": "Aliens"}`, errTrailingData},
+		{`{"title": "Alien"}}`, errTrailingData},
+		{`{"title": "Alien"} garbage`, errTrailingData},
+		{`{"title": "Alien"}[]`, errTrailingData},
+	}
+	for _, tt := range tests {
+		var v CreateMovieRequest
+		if err := decodeBody(strings.NewReader(tt.body), &v); !errors.Is(err, tt.want) {
+			t.Errorf("decodeBody(%q) = %v, want %v", tt.body, err, tt.want)
+		}
+	}
+
+	var v CreateMovieRequest
+	err := decodeBody(strings.NewReader(`{"titel": "Alien"}`), &v)
+	if field, ok := unknownField(err); !ok || field != "titel" {
+		t.Errorf("decodeBody of an unknown field = %v, want the field titel", err)
+	}
+}
+
+func TestBodyErrors(t *testing.T) {
+	s := newTestServer(t)
+	_, auth := s.mustCreateUser(t, "admin", storage.UserRoleAdmin)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   tools.ErrorCode
+		fields []string
+	}{
+		{"trailing data", testMovie + `{"title": "Aliens"}`, http.StatusBadRequest, tools.CodeInvalidBody, nil},
+		{"not json", `title=Alien`, http.StatusBadRequest, tools.CodeInvalidBody, nil},
+		{"unknown field", `{"titel": "Alien"}`, http.StatusBadRequest, tools.CodeInvalidBody, []string{"titel"}},
+		{"wrong type", `{"title": "Alien", "rating": "nine"}`, http.StatusBadRequest, tools.CodeInvalidBody, []string{"rating"}},
+		{"invalid fields", `{
+			"title": " ",
+			"description": "` + strings.Repeat("x", maxDescriptionLength+1) + `",
+			"rating": 11,
+			"actors": [{"actor_id": 0, "billing": -1}]
+		}`, http.StatusUnprocessableEntity, tools.CodeValidation,
+			[]string{"title", "description", "rating", "actors[0].actor_id", "actors[0].billing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(http.MethodPost, "/api/v2/movies", tt.body, "Authorization", auth)
+			wantStatus(t, w, tt.status)
+			p := decodeProblem(t, w)
+			if p.Code != tt.code {
+				t.Errorf("code = %q, want %q", p.Code, tt.code)
+			}
+
+			var fields []string
+			for _, e := range p.Errors {
+				if e.Message == "" {
+					t.Errorf("field %s has no message", e.Field)
+				}
+				fields = append(fields, e.Field)
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+
+	movies, err := s.store.GetMovies(context.Background(), storage.MovieFilter{}, nil, storage.Page{})
+	if err != nil || movies.Total != 0 {
+		t.Errorf("GetMovies = %d movies, %v; invalid bodies must not create any", movies.Total, err)
+	}
+}
@@ -0,0 +1,269 @@
+// Package migrate applies the numbered schema migrations in sql/ to the
+// movies database. Every migration NNNN_name has an up and a down script;
+// the applied version is kept in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey is the pg_advisory_lock key that serializes migration runs, so
+// several service instances starting at once do not race each other.
+const lockKey = 4_206_713_001
+
+var ErrDirty = errors.New("database is dirty: a migration failed part-way, fix it and run migrate force")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version int
+	Dirty   bool
+	Pending []Migration
+}
+
+type Migrator struct {
+	conn       *pgx.Conn
+	migrations []Migration
+}
+
+func New(ctx context.Context, connString string) (*Migrator, error) {
+	migrations, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect: %w", err)
+	}
+
+	m := &Migrator{conn: conn, migrations: migrations}
+	if err := m.init(ctx); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Migrator) Close(ctx context.Context) error {
+	return m.conn.Close(ctx)
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		version, err := m.version(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if mig.Version <= version {
+				continue
+			}
+			if err := m.apply(ctx, mig.Version, mig.Up); err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func() error {
+		version, err := m.version(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := m.migrations[i]
+			if mig.Version > version {
+				continue
+			}
+
+			previous := 0
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err := m.apply(ctx, previous, mig.Down); err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", mig.Version, mig.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+
+	err := m.conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations`).Scan(&status.Version, &status.Dirty)
+	if err != nil {
+		return status, fmt.Errorf("unable to query: %w", err)
+	}
+
+	for _, mig := range m.migrations {
+		if mig.Version > status.Version {
+			status.Pending = append(status.Pending, mig)
+		}
+	}
+	return status, nil
+}
+
+// Force records version as applied and clears the dirty flag without running
+// any migration. It is the way out after a failed migration was repaired by
+// hand.
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	if version != 0 && m.find(version) < 0 {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.locked(ctx, func() error {
+		_, err := m.conn.Exec(ctx, `UPDATE schema_migrations SET version = $1, dirty = false`, version)
+		if err != nil {
+			return fmt.Errorf("unable to update version: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) init(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		_, err := m.conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+			version INT     NOT NULL,
+			dirty   BOOLEAN NOT NULL
+		)`)
+		if err != nil {
+			return fmt.Errorf("unable to create schema_migrations: %w", err)
+		}
+
+		_, err = m.conn.Exec(ctx, `INSERT INTO schema_migrations (version, dirty)
+		SELECT 0, false WHERE NOT EXISTS (SELECT 1 FROM schema_migrations)`)
+		if err != nil {
+			return fmt.Errorf("unable to init schema_migrations: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	if _, err := m.conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("unable to take migration lock: %w", err)
+	}
+	defer m.conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	return fn()
+}
+
+// version returns the applied version and fails with ErrDirty while the
+// dirty flag is raised.
+func (m *Migrator) version(ctx context.Context) (int, error) {
+	var version int
+	var dirty bool
+
+	err := m.conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations`).Scan(&version, &dirty)
+	if err != nil {
+		return 0, fmt.Errorf("unable to query version: %w", err)
+	}
+	if dirty {
+		return version, ErrDirty
+	}
+	return version, nil
+}
+
+// apply runs script and moves the recorded version to version in one
+// transaction. The dirty flag is raised beforehand and stays raised if the
+// script fails.
+func (m *Migrator) apply(ctx context.Context, version int, script string) error {
+	if _, err := m.conn.Exec(ctx, `UPDATE schema_migrations SET dirty = true`); err != nil {
+		return fmt.Errorf("unable to mark dirty: %w", err)
+	}
+
+	return pgx.BeginFunc(ctx, m.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, script); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `UPDATE schema_migrations SET version = $1, dirty = false`, version)
+		return err
+	})
+}
+
+func (m *Migrator) find(version int) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// load reads the embedded NNNN_name.up.sql/NNNN_name.down.sql pairs in
+// version order.
+func load() ([]Migration, error) {
+	names, err := fs.Glob(files, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, name := range names {
+		base := path.Base(name)
+		prefix, rest, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("bad migration file name %s", base)
+		}
+
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version}
+			byVersion[version] = mig
+		}
+		switch {
+		case strings.HasSuffix(rest, ".up.sql"):
+			mig.Name = strings.TrimSuffix(rest, ".up.sql")
+			mig.Up = string(data)
+		case strings.HasSuffix(rest, ".down.sql"):
+			mig.Down = string(data)
+		default:
+			return nil, fmt.Errorf("bad migration file name %s", base)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d needs both an up and a down script", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
@@ -0,0 +1,3 @@
+DROP TABLE movie_actor;
+DROP TABLE actor;
+DROP TABLE movie;
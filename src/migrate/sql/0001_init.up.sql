@@ -0,0 +1,25 @@
+-- Baseline schema. IF NOT EXISTS keeps it safe on databases that were
+-- created by the old docker init script.
+CREATE TABLE IF NOT EXISTS movie
+(
+    id           SERIAL PRIMARY KEY,
+    title        VARCHAR(150)  NOT NULL,
+    description  VARCHAR(1000) NOT NULL,
+    release_date VARCHAR(30)   NOT NULL,
+    rating       INT           NOT NULL
+        CHECK (rating BETWEEN 0 AND 10)
+);
+
+CREATE TABLE IF NOT EXISTS actor
+(
+    id        SERIAL PRIMARY KEY,
+    name      VARCHAR(80) NOT NULL,
+    gender    VARCHAR(30),
+    birthday  VARCHAR(30)
+);
+
+CREATE TABLE IF NOT EXISTS movie_actor
+(
+    movie_id      INT REFERENCES movie (id),
+    actor_id      INT REFERENCES actor (id)
+);
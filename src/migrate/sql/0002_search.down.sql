@@ -0,0 +1,3 @@
+DROP INDEX actor_name_trgm_idx;
+DROP INDEX movie_title_trgm_idx;
+DROP INDEX movie_search_idx;
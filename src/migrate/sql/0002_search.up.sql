@@ -0,0 +1,6 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS movie_search_idx ON movie USING gin
+    (to_tsvector('simple', translate(lower(title), 'ё', 'е') || ' ' || translate(lower(description), 'ё', 'е')));
+CREATE INDEX IF NOT EXISTS movie_title_trgm_idx ON movie USING gin (translate(lower(title), 'ё', 'е') gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS actor_name_trgm_idx ON actor USING gin (translate(lower(name), 'ё', 'е') gin_trgm_ops);
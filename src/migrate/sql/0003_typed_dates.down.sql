@@ -0,0 +1,20 @@
+ALTER TABLE movie
+    DROP CONSTRAINT movie_release_date_precision_check,
+    ALTER COLUMN release_date TYPE VARCHAR(30) USING CASE release_date_precision
+        WHEN 1 THEN to_char(release_date, 'YYYY')
+        WHEN 2 THEN to_char(release_date, 'YYYY-MM')
+        ELSE COALESCE(to_char(release_date, 'YYYY-MM-DD'), '')
+    END,
+    ALTER COLUMN release_date SET NOT NULL;
+ALTER TABLE movie
+    DROP COLUMN release_date_precision;
+
+ALTER TABLE actor
+    DROP CONSTRAINT actor_birthday_precision_check,
+    ALTER COLUMN birthday TYPE VARCHAR(30) USING CASE birthday_precision
+        WHEN 1 THEN to_char(birthday, 'YYYY')
+        WHEN 2 THEN to_char(birthday, 'YYYY-MM')
+        ELSE to_char(birthday, 'YYYY-MM-DD')
+    END;
+ALTER TABLE actor
+    DROP COLUMN birthday_precision;
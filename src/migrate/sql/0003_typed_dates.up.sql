@@ -0,0 +1,46 @@
+-- release_date and birthday become DATE. A date known only to the year or
+-- month is stored as the first day of that period, with the number of known
+-- components (1 year, 2 year-month, 3 full date) in the *_precision column.
+-- Old values that are not ISO-8601 dates are dropped to NULL.
+CREATE FUNCTION pg_temp.partial_date(value TEXT) RETURNS DATE AS
+$$
+BEGIN
+    RETURN CASE
+        WHEN value ~ '^\d{4}-\d{2}-\d{2}$' THEN value::DATE
+        WHEN value ~ '^\d{4}-\d{2}$' THEN (value || '-01')::DATE
+        WHEN value ~ '^\d{4}$' THEN (value || '-01-01')::DATE
+    END;
+EXCEPTION
+    WHEN others THEN RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION pg_temp.date_precision(value TEXT) RETURNS SMALLINT AS
+$$
+    SELECT CASE
+        WHEN pg_temp.partial_date(value) IS NULL THEN NULL
+        WHEN length(value) = 4 THEN 1
+        WHEN length(value) = 7 THEN 2
+        ELSE 3
+    END::SMALLINT;
+$$ LANGUAGE sql;
+
+ALTER TABLE movie
+    ADD COLUMN release_date_precision SMALLINT;
+UPDATE movie SET release_date_precision = pg_temp.date_precision(release_date);
+ALTER TABLE movie
+    ALTER COLUMN release_date DROP NOT NULL,
+    ALTER COLUMN release_date TYPE DATE USING pg_temp.partial_date(release_date),
+    ADD CONSTRAINT movie_release_date_precision_check
+        CHECK ((release_date IS NULL) = (release_date_precision IS NULL) AND release_date_precision BETWEEN 1 AND 3);
+
+ALTER TABLE actor
+    ADD COLUMN birthday_precision SMALLINT;
+UPDATE actor SET birthday_precision = pg_temp.date_precision(birthday);
+ALTER TABLE actor
+    ALTER COLUMN birthday TYPE DATE USING pg_temp.partial_date(birthday),
+    ADD CONSTRAINT actor_birthday_precision_check
+        CHECK ((birthday IS NULL) = (birthday_precision IS NULL) AND birthday_precision BETWEEN 1 AND 3);
+
+DROP FUNCTION pg_temp.date_precision(TEXT);
+DROP FUNCTION pg_temp.partial_date(TEXT);
@@ -0,0 +1,6 @@
+DROP INDEX movie_actor_actor_id_idx;
+ALTER TABLE movie_actor
+    DROP CONSTRAINT movie_actor_pkey;
+ALTER TABLE movie_actor
+    ALTER COLUMN movie_id DROP NOT NULL,
+    ALTER COLUMN actor_id DROP NOT NULL;
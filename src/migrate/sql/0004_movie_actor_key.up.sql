@@ -0,0 +1,10 @@
+-- A movie links to an actor at most once. Duplicate and dangling links left
+-- by older versions are dropped first.
+DELETE FROM movie_actor WHERE movie_id IS NULL OR actor_id IS NULL;
+DELETE FROM movie_actor a
+    USING movie_actor b
+    WHERE a.movie_id = b.movie_id AND a.actor_id = b.actor_id AND a.ctid > b.ctid;
+
+ALTER TABLE movie_actor
+    ADD CONSTRAINT movie_actor_pkey PRIMARY KEY (movie_id, actor_id);
+CREATE INDEX movie_actor_actor_id_idx ON movie_actor (actor_id);
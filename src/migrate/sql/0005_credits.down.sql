@@ -0,0 +1,7 @@
+ALTER TABLE movie_actor
+    DROP CONSTRAINT movie_actor_role_check,
+    DROP CONSTRAINT movie_actor_billing_check;
+ALTER TABLE movie_actor
+    DROP COLUMN role,
+    DROP COLUMN billing,
+    DROP COLUMN character_name;
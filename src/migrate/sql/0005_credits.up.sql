@@ -0,0 +1,8 @@
+-- What an actor plays in a movie: the character, the position in the
+-- credits (0 is unbilled) and the kind of part.
+ALTER TABLE movie_actor
+    ADD COLUMN character_name VARCHAR(150) NOT NULL DEFAULT '',
+    ADD COLUMN billing        INT          NOT NULL DEFAULT 0,
+    ADD COLUMN role           VARCHAR(10)  NOT NULL DEFAULT '',
+    ADD CONSTRAINT movie_actor_billing_check CHECK (billing >= 0),
+    ADD CONSTRAINT movie_actor_role_check CHECK (role IN ('', 'lead', 'supporting', 'cameo', 'voice'));
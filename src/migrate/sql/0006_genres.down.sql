@@ -0,0 +1,2 @@
+DROP TABLE movie_genre;
+DROP TABLE genre;
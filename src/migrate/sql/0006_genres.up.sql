@@ -0,0 +1,15 @@
+CREATE TABLE genre
+(
+    id   SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL
+);
+-- Genre names are unique regardless of case; filters compare lower(name).
+CREATE UNIQUE INDEX genre_name_key ON genre (lower(name));
+
+CREATE TABLE movie_genre
+(
+    movie_id INT NOT NULL REFERENCES movie (id),
+    genre_id INT NOT NULL REFERENCES genre (id),
+    CONSTRAINT movie_genre_pkey PRIMARY KEY (movie_id, genre_id)
+);
+CREATE INDEX movie_genre_genre_id_idx ON movie_genre (genre_id);
@@ -0,0 +1,12 @@
+DROP TABLE movie_crew;
+
+ALTER TABLE person
+    DROP CONSTRAINT person_known_for_check,
+    DROP COLUMN known_for;
+
+ALTER TABLE person
+    RENAME CONSTRAINT person_birthday_precision_check TO actor_birthday_precision_check;
+ALTER INDEX person_name_trgm_idx RENAME TO actor_name_trgm_idx;
+ALTER INDEX person_pkey RENAME TO actor_pkey;
+ALTER SEQUENCE person_id_seq RENAME TO actor_id_seq;
+ALTER TABLE person RENAME TO actor;
@@ -0,0 +1,27 @@
+-- Actors become people: anyone who worked on a movie, known for one
+-- department. Acting credits stay in movie_actor; the rest of the crew is in
+-- movie_crew.
+ALTER TABLE actor RENAME TO person;
+ALTER SEQUENCE actor_id_seq RENAME TO person_id_seq;
+ALTER INDEX actor_pkey RENAME TO person_pkey;
+ALTER INDEX actor_name_trgm_idx RENAME TO person_name_trgm_idx;
+ALTER TABLE person
+    RENAME CONSTRAINT actor_birthday_precision_check TO person_birthday_precision_check;
+
+ALTER TABLE person
+    ADD COLUMN known_for VARCHAR(20) NOT NULL DEFAULT 'acting',
+    ADD CONSTRAINT person_known_for_check CHECK (known_for IN
+        ('acting', 'directing', 'writing', 'production', 'camera', 'editing', 'sound', 'art'));
+
+-- A person may hold several jobs in one department, e.g. Screenplay and Story.
+CREATE TABLE movie_crew
+(
+    movie_id   INT         NOT NULL REFERENCES movie (id),
+    person_id  INT         NOT NULL REFERENCES person (id),
+    department VARCHAR(20) NOT NULL,
+    job        VARCHAR(80) NOT NULL DEFAULT '',
+    CONSTRAINT movie_crew_department_check CHECK (department IN
+        ('directing', 'writing', 'production', 'camera', 'editing', 'sound', 'art')),
+    CONSTRAINT movie_crew_pkey PRIMARY KEY (movie_id, person_id, department, job)
+);
+CREATE INDEX movie_crew_person_id_idx ON movie_crew (person_id);
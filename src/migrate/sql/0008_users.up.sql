@@ -0,0 +1,11 @@
+-- Accounts for basic auth. Passwords are stored as bcrypt hashes; usernames
+-- are unique regardless of case.
+CREATE TABLE users
+(
+    id            SERIAL PRIMARY KEY,
+    username      VARCHAR(80) NOT NULL,
+    password_hash BYTEA       NOT NULL,
+    disabled      BOOLEAN     NOT NULL DEFAULT false,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX users_username_key ON users (lower(username));
@@ -0,0 +1,7 @@
+-- Users get a role. Existing users could do everything, so they become
+-- admins; new users are viewers unless created with a role.
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(10) NOT NULL DEFAULT 'admin',
+    ADD CONSTRAINT users_role_check CHECK (role IN ('viewer', 'editor', 'admin'));
+ALTER TABLE users
+    ALTER COLUMN role SET DEFAULT 'viewer';
@@ -0,0 +1,19 @@
+-- Refresh tokens are kept as SHA-256 hashes. Refreshing revokes the token and
+-- issues the next one of its family; revoked tokens stay to detect reuse.
+CREATE TABLE refresh_token
+(
+    token_hash CHAR(64)    PRIMARY KEY,
+    user_id    INT         NOT NULL REFERENCES users (id),
+    family     VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX refresh_token_family_idx ON refresh_token (family);
+
+-- Access tokens revoked by logging out, until they expire anyway.
+CREATE TABLE revoked_token
+(
+    jti        VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
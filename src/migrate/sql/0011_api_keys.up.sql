@@ -0,0 +1,12 @@
+-- API keys for integrations. Keys are stored as SHA-256 hashes; prefix is
+-- the start of the key, shown to tell keys apart.
+CREATE TABLE api_key
+(
+    id           SERIAL PRIMARY KEY,
+    name         VARCHAR(80) NOT NULL,
+    prefix       VARCHAR(16) NOT NULL,
+    key_hash     CHAR(64)    NOT NULL UNIQUE,
+    scopes       TEXT[]      NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
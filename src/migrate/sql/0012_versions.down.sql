@@ -0,0 +1,4 @@
+ALTER TABLE person
+    DROP COLUMN version;
+ALTER TABLE movie
+    DROP COLUMN version;
@@ -0,0 +1,7 @@
+-- Every change to a movie or person, including one that only shows through
+-- it such as a renamed actor in a cast, raises its version. The version is
+-- the ETag of the movie or person; changes made against an older one fail.
+ALTER TABLE movie
+    ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE person
+    ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,16 @@
+package storage
+
+import "time"
+
+// APIKey is a credential for integrations, not tied to a user. Only the
+// SHA-256 of the key is kept; Prefix is its start, to tell keys apart.
+// Scopes are the "resource:action" pairs the key may do, see tools.Scope.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Hash       string     `json:"-"`
+}
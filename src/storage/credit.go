@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ErrInvalidCredit wraps the reason a credit was rejected.
+var ErrInvalidCredit error = &kindError{kind: ErrValidation, msg: "invalid credit"}
+
+// Role is the kind of part an actor is credited with.
+type Role string
+
+const (
+	RoleLead       Role = "lead"
+	RoleSupporting Role = "supporting"
+	RoleCameo      Role = "cameo"
+	RoleVoice      Role = "voice"
+)
+
+var roles = []Role{RoleLead, RoleSupporting, RoleCameo, RoleVoice}
+
+// Valid reports whether r is one of the known roles or empty.
+func (r Role) Valid() bool {
+	if r == "" {
+		return true
+	}
+	for _, v := range roles {
+		if r == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Role) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("role must be a string")
+	}
+	if !Role(s).Valid() {
+		return fmt.Errorf("unknown role %q, allowed roles: lead, supporting, cameo, voice", s)
+	}
+	*r = Role(s)
+	return nil
+}
+
+// Part is what an actor plays in a movie. Billing is the position in the
+// credits, starting at 1; 0 means unbilled. Casts and filmographies are
+// ordered by billing, unbilled parts last, then by ID.
+type Part struct {
+	Character string `json:"character,omitempty"`
+	Billing   int    `json:"billing,omitempty"`
+	Role      Role   `json:"role,omitempty"`
+}
+
+func (p Part) validate() error {
+	if p.Billing < 0 {
+		return fmt.Errorf("%w: billing %d must not be negative", ErrInvalidCredit, p.Billing)
+	}
+	if !p.Role.Valid() {
+		return fmt.Errorf("%w: unknown role %q", ErrInvalidCredit, p.Role)
+	}
+	return nil
+}
+
+// creditLess orders parts by billing with the unbilled ones last, then by
+// the ID of the actor or movie.
+func creditLess(a, b Part, aID, bID int) bool {
+	if (a.Billing == 0) != (b.Billing == 0) {
+		return b.Billing == 0
+	}
+	if a.Billing != b.Billing {
+		return a.Billing < b.Billing
+	}
+	return aID < bID
+}
+
+// Credit links an actor to a movie. In JSON it is either an object or, for a
+// credit without any details, just the actor ID.
+type Credit struct {
+	ActorID int `json:"actor_id"`
+	Part
+}
+
+func (c *Credit) UnmarshalJSON(data []byte) error {
+	var id int
+	if err := json.Unmarshal(data, &id); err == nil {
+		*c = Credit{ActorID: id}
+		return nil
+	}
+
+	type credit Credit
+	return json.Unmarshal(data, (*credit)(c))
+}
+
+// Credits turns plain actor IDs into credits without details.
+func Credits(actors ...int) []Credit {
+	credits := make([]Credit, 0, len(actors))
+	for _, id := range actors {
+		credits = append(credits, Credit{ActorID: id})
+	}
+	return credits
+}
+
+// checkCredits validates the parts and drops repeated actors, keeping the
+// first credit of each. It returns the credits and their actor IDs.
+func checkCredits(credits []Credit) ([]Credit, []int, error) {
+	seen := make(map[int]bool, len(credits))
+	unique := make([]Credit, 0, len(credits))
+	ids := make([]int, 0, len(credits))
+	for _, c := range credits {
+		if err := c.validate(); err != nil {
+			return nil, nil, err
+		}
+		if !seen[c.ActorID] {
+			seen[c.ActorID] = true
+			unique = append(unique, c)
+			ids = append(ids, c.ActorID)
+		}
+	}
+	return unique, ids, nil
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date is a calendar date that may be known only to the year or to the
+// month. Month and Day are 0 when unknown; the zero Date means no date at
+// all. It is written as ISO-8601 "2006", "2006-01" or "2006-01-02".
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// Precisions of a Date, as stored in the *_precision columns: the number of
+// known components.
+const (
+	precisionYear  = 1
+	precisionMonth = 2
+	precisionDay   = 3
+)
+
+// ParseDate reads an ISO-8601 date, "" being the zero Date.
+func ParseDate(s string) (Date, error) {
+	var d Date
+	if s == "" {
+		return d, nil
+	}
+
+	parts := strings.Split(s, "-")
+	if len(parts) > 3 || len(parts[0]) != 4 {
+		return d, fmt.Errorf("invalid date %q, want YYYY, YYYY-MM or YYYY-MM-DD", s)
+	}
+	for i, p := range parts {
+		if (i > 0 && len(p) != 2) || strings.Trim(p, "0123456789") != "" {
+			return d, fmt.Errorf("invalid date %q, want YYYY, YYYY-MM or YYYY-MM-DD", s)
+		}
+	}
+
+	year, err := strconv.Atoi(parts[0])
+	if err != nil || year < 1 {
+		return d, fmt.Errorf("invalid year in date %q", s)
+	}
+	d.Year = year
+
+	if len(parts) > 1 {
+		month, err := strconv.Atoi(parts[1])
+		if err != nil || month < 1 || month > 12 {
+			return Date{}, fmt.Errorf("invalid month in date %q", s)
+		}
+		d.Month = time.Month(month)
+	}
+
+	if len(parts) > 2 {
+		day, err := strconv.Atoi(parts[2])
+		if err != nil || day < 1 || day > daysIn(d.Year, d.Month) {
+			return Date{}, fmt.Errorf("invalid day in date %q", s)
+		}
+		d.Day = day
+	}
+
+	return d, nil
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func (d Date) IsZero() bool {
+	return d.Year == 0
+}
+
+func (d Date) String() string {
+	switch {
+	case d.IsZero():
+		return ""
+	case d.Month == 0:
+		return fmt.Sprintf("%04d", d.Year)
+	case d.Day == 0:
+		return fmt.Sprintf("%04d-%02d", d.Year, d.Month)
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// Start is the first day of the period d covers, End the last one. Both are
+// the zero time for the zero Date.
+func (d Date) Start() time.Time {
+	if d.IsZero() {
+		return time.Time{}
+	}
+	month, day := d.Month, d.Day
+	if month == 0 {
+		month = time.January
+	}
+	if day == 0 {
+		day = 1
+	}
+	return time.Date(d.Year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func (d Date) End() time.Time {
+	switch {
+	case d.IsZero():
+		return time.Time{}
+	case d.Month == 0:
+		return time.Date(d.Year, time.December, 31, 0, 0, 0, 0, time.UTC)
+	case d.Day == 0:
+		return time.Date(d.Year, d.Month, daysIn(d.Year, d.Month), 0, 0, 0, 0, time.UTC)
+	}
+	return d.Start()
+}
+
+func (d Date) precision() int {
+	switch {
+	case d.Month == 0:
+		return precisionYear
+	case d.Day == 0:
+		return precisionMonth
+	}
+	return precisionDay
+}
+
+// dbArgs returns the DATE and precision column values for d, NULL for the
+// zero Date.
+func (d Date) dbArgs() (any, any) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.Start(), d.precision()
+}
+
+// dateFromDB rebuilds a Date from its DATE and precision columns.
+func dateFromDB(t *time.Time, precision *int16) Date {
+	if t == nil {
+		return Date{}
+	}
+
+	d := Date{Year: t.Year(), Month: t.Month(), Day: t.Day()}
+	if precision != nil && *precision < precisionDay {
+		d.Day = 0
+	}
+	if precision != nil && *precision < precisionMonth {
+		d.Month = 0
+	}
+	return d
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = Date{}
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("date must be a string")
+	}
+	parsed, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
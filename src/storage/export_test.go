@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NewTracedPgStorage is NewPgStorage with tracer on every connection, so that
+// tests can see the queries the storage makes.
+func NewTracedPgStorage(ctx context.Context, connString string, tracer pgx.QueryTracer) (*postgres, error) {
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse connection string: %w", err)
+	}
+	config.ConnConfig.Tracer = tracer
+	return newPgStorage(ctx, config)
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MovieFilter narrows movie lists and searches. Both bounds are inclusive and
+// cover the whole period of a partial date: ReleasedAfter "1999" keeps movies
+// from 1999-01-01 on, ReleasedBefore "1999" those up to 1999-12-31. Zero
+// bounds are ignored; movies without a release date never match a bound.
+//
+// Genres keeps movies in any of the named genres, or in all of them with
+// AllGenres. Names are compared case-insensitively; no names keeps every
+// movie.
+type MovieFilter struct {
+	ReleasedAfter  Date
+	ReleasedBefore Date
+	Genres         []string
+	AllGenres      bool
+}
+
+// ActorFilter narrows actor lists by birthday, like MovieFilter.
+type ActorFilter struct {
+	BornAfter  Date
+	BornBefore Date
+}
+
+func (f MovieFilter) conditions(args []any) ([]string, []any) {
+	conditions, args := dateRange("movie.release_date", f.ReleasedAfter, f.ReleasedBefore, args)
+
+	keys := genreKeys(f.Genres)
+	if len(keys) == 0 {
+		return conditions, args
+	}
+	args = append(args, keys)
+	subquery := fmt.Sprintf(`SELECT movie_genre.movie_id FROM movie_genre
+			JOIN genre ON genre.id = movie_genre.genre_id
+			WHERE lower(genre.name) = ANY($%d)`, len(args))
+	if f.AllGenres {
+		args = append(args, len(keys))
+		subquery += fmt.Sprintf(` GROUP BY movie_genre.movie_id HAVING count(*) = $%d`, len(args))
+	}
+	return append(conditions, "movie.id IN ("+subquery+")"), args
+}
+
+func (f MovieFilter) match(v MovieInfo) bool {
+	if !inRange(v.Release_date, f.ReleasedAfter, f.ReleasedBefore) {
+		return false
+	}
+
+	keys := genreKeys(f.Genres)
+	if len(keys) == 0 {
+		return true
+	}
+	has := make(map[string]bool, len(v.Genres))
+	for _, g := range v.Genres {
+		has[strings.ToLower(g.Name)] = true
+	}
+	found := 0
+	for _, key := range keys {
+		if has[key] {
+			found++
+		}
+	}
+	if f.AllGenres {
+		return found == len(keys)
+	}
+	return found > 0
+}
+
+func (f ActorFilter) conditions(args []any) ([]string, []any) {
+	return dateRange("actor.birthday", f.BornAfter, f.BornBefore, args)
+}
+
+func (f ActorFilter) match(d Date) bool {
+	return inRange(d, f.BornAfter, f.BornBefore)
+}
+
+// dateRange renders the SQL bounds on column. Placeholders are numbered from
+// len(args)+1, as in keysetCondition.
+func dateRange(column string, after, before Date, args []any) ([]string, []any) {
+	var conditions []string
+	if !after.IsZero() {
+		args = append(args, after.Start())
+		conditions = append(conditions, fmt.Sprintf("%s >= $%d", column, len(args)))
+	}
+	if !before.IsZero() {
+		args = append(args, before.End())
+		conditions = append(conditions, fmt.Sprintf("%s <= $%d", column, len(args)))
+	}
+	return conditions, args
+}
+
+func inRange(d, after, before Date) bool {
+	if after.IsZero() && before.IsZero() {
+		return true
+	}
+	if d.IsZero() {
+		return false
+	}
+	start := d.Start()
+	return (after.IsZero() || !start.Before(after.Start())) &&
+		(before.IsZero() || !start.After(before.End()))
+}
+
+// whereClause joins conditions into a WHERE clause, or returns "" for none.
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Genre struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// GenreCount is a genre with the number of movies in it. In a MoviesPage it
+// counts the movies that match the filter, across all pages.
+type GenreCount struct {
+	Genre
+	Count int `json:"count"`
+}
+
+// ErrGenreExists is returned when a genre is created or renamed to a name
+// that another genre has. Names are compared case-insensitively.
+var ErrGenreExists error = &kindError{kind: ErrConflict, msg: "genre already exists"}
+
+// UnknownGenresError reports genre IDs that a movie was to be tagged with but
+// that do not exist.
+type UnknownGenresError struct {
+	IDs []int
+}
+
+func (e *UnknownGenresError) Error() string {
+	ids := make([]string, len(e.IDs))
+	for i, id := range e.IDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return fmt.Sprintf("unknown genre ids: %s", strings.Join(ids, ", "))
+}
+
+func (e *UnknownGenresError) Unwrap() error { return ErrValidation }
+
+// genresSQL lists the genres of the movie of the current row as JSON that
+// scans into []Genre, by name.
+const genresSQL = `(SELECT COALESCE(json_agg(json_build_object('id', genre.id, 'name', genre.name) ORDER BY genre.name), '[]')
+		FROM movie_genre
+		JOIN genre ON genre.id = movie_genre.genre_id
+		WHERE movie_genre.movie_id = movie.id)`
+
+// genreKeys folds genre names for comparison and drops repeats and blanks.
+func genreKeys(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// uniqueIDs drops repeated IDs, keeping the order.
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,1146 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type movieActor struct {
+	movieID int
+	actorID int
+	Part
+}
+
+type storedToken struct {
+	RefreshToken
+	revoked bool
+}
+
+type movieCrew struct {
+	movieID int
+	CrewCredit
+}
+
+type memory struct {
+	mu           sync.RWMutex
+	movies       map[int]Movie
+	people       map[int]Person
+	links        []movieActor
+	crew         []movieCrew
+	genres       map[int]Genre
+	movieGenres  map[int][]int
+	users        map[int]User
+	tokens       map[string]storedToken
+	revoked      map[string]time.Time
+	apiKeys      map[int]APIKey
+	nextMovieID  int
+	nextPersonID int
+	nextGenreID  int
+	nextUserID   int
+	nextKeyID    int
+}
+
+func NewMemStorage() *memory {
+	return &memory{
+		movies:      make(map[int]Movie),
+		people:      make(map[int]Person),
+		genres:      make(map[int]Genre),
+		movieGenres: make(map[int][]int),
+		users:       make(map[int]User),
+		tokens:      make(map[string]storedToken),
+		revoked:     make(map[string]time.Time),
+		apiKeys:     make(map[int]APIKey),
+	}
+}
+
+// Ping always succeeds, as there is nothing to reach.
+func (m *memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Close() {}
+
+func (m *memory) GetMovies(ctx context.Context, filter MovieFilter, sort []SortKey, page Page) (MoviesPage, error) {
+	var moviesPage MoviesPage
+
+	if err := checkSort(sort, movieFields); err != nil {
+		return moviesPage, err
+	}
+	c, before, err := page.decode(sort, movieFields)
+	if err != nil {
+		return moviesPage, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	moviesInfo := m.moviesInfo(filter)
+	moviesPage.Total = len(moviesInfo)
+	moviesPage.Genres = genreFacet(moviesInfo)
+	moviesInfo = paginate(moviesInfo, sort, page, c, before, movieValue, func(v MovieInfo) int { return v.ID })
+	moviesPage.Movies, moviesPage.PrevCursor, moviesPage.NextCursor = finishPage(moviesInfo, page, c, before,
+		func(v MovieInfo) string { return encodeCursor(sortValues(v, sort, movieValue), v.ID) })
+
+	return moviesPage, nil
+}
+
+func (m *memory) GetActors(ctx context.Context, filter ActorFilter, sort []SortKey, page Page) (ActorsPage, error) {
+	var actorsPage ActorsPage
+
+	if err := checkSort(sort, actorFields); err != nil {
+		return actorsPage, err
+	}
+	c, before, err := page.decode(sort, actorFields)
+	if err != nil {
+		return actorsPage, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filmography := make(map[int][]movieActor)
+	for _, l := range m.links {
+		filmography[l.actorID] = append(filmography[l.actorID], l)
+	}
+
+	actorsInfo := make([]ActorInfo, 0, len(m.people))
+	for _, v := range m.people {
+		if !isActor(v, filmography[v.ID]) || !filter.match(v.Birthday) {
+			continue
+		}
+		actorsInfo = append(actorsInfo, ActorInfo{
+			ID:       v.ID,
+			Name:     v.Name,
+			Gender:   v.Gender,
+			Birthday: v.Birthday,
+			Movies:   m.movieTitles(filmography[v.ID]),
+		})
+	}
+
+	actorsPage.Total = len(actorsInfo)
+	actorsInfo = paginate(actorsInfo, sort, page, c, before, actorValue, func(v ActorInfo) int { return v.ID })
+	actorsPage.Actors, actorsPage.PrevCursor, actorsPage.NextCursor = finishPage(actorsInfo, page, c, before,
+		func(v ActorInfo) string { return encodeCursor(sortValues(v, sort, actorValue), v.ID) })
+
+	return actorsPage, nil
+}
+
+func (m *memory) GetMovie(ctx context.Context, id int) (MovieInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return MovieInfo{}, ErrNotFound
+	}
+
+	var cast []movieActor
+	for _, l := range m.links {
+		if l.movieID == id {
+			cast = append(cast, l)
+		}
+	}
+
+	return MovieInfo{
+		ID:           movie.ID,
+		Title:        movie.Title,
+		Description:  movie.Description,
+		Release_date: movie.Release_date,
+		Rating:       movie.Rating,
+		Actors:       m.actorNames(cast),
+		Genres:       m.genresOf(id),
+		Crew:         m.crewOf(id),
+		Version:      movie.Version,
+	}, nil
+}
+
+func (m *memory) GetActor(ctx context.Context, id int) (ActorInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	actor, ok := m.people[id]
+	if !ok {
+		return ActorInfo{}, ErrNotFound
+	}
+
+	var filmography []movieActor
+	for _, l := range m.links {
+		if l.actorID == id {
+			filmography = append(filmography, l)
+		}
+	}
+	if !isActor(actor, filmography) {
+		return ActorInfo{}, ErrNotFound
+	}
+
+	return ActorInfo{
+		ID:       actor.ID,
+		Name:     actor.Name,
+		Gender:   actor.Gender,
+		Birthday: actor.Birthday,
+		Movies:   m.movieTitles(filmography),
+		Version:  actor.Version,
+	}, nil
+}
+
+func (m *memory) SearchMovies(ctx context.Context, search string, filter MovieFilter, sort []SortKey, page Page) (SearchPage, error) {
+	var searchPage SearchPage
+
+	if err := checkSort(sort, searchFields); err != nil {
+		return searchPage, err
+	}
+	if sort == nil {
+		sort = []SortKey{{Field: "relevance", Desc: true}}
+	}
+	if page.After != "" || page.Before != "" {
+		return searchPage, ErrInvalidCursor
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := []MovieSearchResult{}
+	for _, v := range m.moviesInfo(filter) {
+		if score, ok := matchMovie(v, search); ok {
+			results = append(results, MovieSearchResult{MovieInfo: v, Score: score})
+		}
+	}
+
+	searchPage.Total = len(results)
+	results = paginate(results, sort, page, nil, false, searchValue, func(v MovieSearchResult) int { return v.ID })
+	if page.Limit > 0 && len(results) > page.Limit {
+		results = results[:page.Limit]
+	}
+	for i := range results {
+		results[i].Highlights = highlightMovie(results[i].MovieInfo, search)
+	}
+	searchPage.Results = results
+
+	return searchPage, nil
+}
+
+func (m *memory) CreateMovie(ctx context.Context, title string, description string, release_date Date, rating int, actors []Credit, genres []int) error {
+	if rating < 0 || rating > 10 {
+		return fmt.Errorf("unable to insert row: %w", &kindError{kind: ErrValidation, msg: fmt.Sprintf("rating %d is out of range", rating)})
+	}
+	actors, actorIDs, err := checkCredits(actors)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkActors(actorIDs); err != nil {
+		return err
+	}
+	genres = uniqueIDs(genres)
+	if err := m.checkGenres(genres); err != nil {
+		return err
+	}
+
+	m.nextMovieID++
+	id := m.nextMovieID
+	m.movies[id] = Movie{
+		ID:           id,
+		Title:        title,
+		Description:  description,
+		Release_date: release_date,
+		Rating:       rating,
+		Version:      1,
+	}
+
+	m.link(id, actors)
+	m.movieGenres[id] = genres
+
+	return nil
+}
+
+func (m *memory) AddMovieActors(ctx context.Context, movieID int, version int, actors []Credit) error {
+	actors, actorIDs, err := checkCredits(actors)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkCast(movieID, version, actorIDs); err != nil {
+		return err
+	}
+	m.link(movieID, actors)
+	m.bumpCast(movieID)
+
+	return nil
+}
+
+func (m *memory) RemoveMovieActors(ctx context.Context, movieID int, version int, actors []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkMovie(movieID, version); err != nil {
+		return err
+	}
+	m.bumpCast(movieID)
+	m.links = filterLinks(m.links, func(l movieActor) bool {
+		return l.movieID != movieID || !slices.Contains(actors, l.actorID)
+	})
+
+	return nil
+}
+
+func (m *memory) ReplaceMovieActors(ctx context.Context, movieID int, version int, actors []Credit) error {
+	actors, actorIDs, err := checkCredits(actors)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkCast(movieID, version, actorIDs); err != nil {
+		return err
+	}
+	m.bumpCast(movieID)
+	m.links = filterLinks(m.links, func(l movieActor) bool { return l.movieID != movieID })
+	m.link(movieID, actors)
+	m.bumpCast(movieID)
+
+	return nil
+}
+
+// checkMovie reports a missing movie, or one whose version is not version,
+// like checkVersion in postgres. It must be called with m.mu held.
+func (m *memory) checkMovie(movieID int, version int) error {
+	movie, ok := m.movies[movieID]
+	if !ok {
+		return ErrNotFound
+	}
+	return matchVersion(movie.Version, version)
+}
+
+// checkCast is checkMovie followed by checkActors. It must be called with
+// m.mu held.
+func (m *memory) checkCast(movieID int, version int, actors []int) error {
+	if err := m.checkMovie(movieID, version); err != nil {
+		return err
+	}
+	return m.checkActors(actors)
+}
+
+func (m *memory) checkActors(actors []int) error {
+	found := make([]int, 0, len(actors))
+	for _, v := range actors {
+		if _, ok := m.people[v]; ok {
+			found = append(found, v)
+		}
+	}
+	return missingActors(actors, found)
+}
+
+// link links the movie to the actors of credits, which must be unique, and
+// overwrites the parts of links that already exist. It must be called with
+// m.mu held.
+func (m *memory) link(movieID int, credits []Credit) {
+	linked := make(map[int]int)
+	for i, l := range m.links {
+		if l.movieID == movieID {
+			linked[l.actorID] = i
+		}
+	}
+
+	for _, c := range credits {
+		if i, ok := linked[c.ActorID]; ok {
+			m.links[i].Part = c.Part
+			continue
+		}
+		m.links = append(m.links, movieActor{movieID: movieID, actorID: c.ActorID, Part: c.Part})
+	}
+}
+
+func (m *memory) CreateActor(ctx context.Context, name, gender string, birthday Date) error {
+	return m.CreatePerson(ctx, name, gender, birthday, DepartmentActing)
+}
+
+func (m *memory) CreatePerson(ctx context.Context, name, gender string, birthday Date, knownFor Department) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextPersonID++
+	id := m.nextPersonID
+	m.people[id] = Person{
+		ID:       id,
+		Name:     name,
+		Gender:   gender,
+		Birthday: birthday,
+		KnownFor: knownFor,
+		Version:  1,
+	}
+
+	return nil
+}
+
+func (m *memory) DeleteMovie(ctx context.Context, id int, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return nil
+	}
+	if err := matchVersion(movie.Version, version); err != nil {
+		return err
+	}
+	m.bumpCredited(id)
+
+	m.links = filterLinks(m.links, func(l movieActor) bool { return l.movieID != id })
+	m.crew = slices.DeleteFunc(m.crew, func(c movieCrew) bool { return c.movieID == id })
+	delete(m.movieGenres, id)
+	delete(m.movies, id)
+
+	return nil
+}
+
+func (m *memory) DeleteActor(ctx context.Context, id int, version int) error {
+	return m.DeletePerson(ctx, id, version)
+}
+
+func (m *memory) DeletePerson(ctx context.Context, id int, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	person, ok := m.people[id]
+	if !ok {
+		return nil
+	}
+	if err := matchVersion(person.Version, version); err != nil {
+		return err
+	}
+	m.bumpFilmography(id)
+
+	m.links = filterLinks(m.links, func(l movieActor) bool { return l.actorID != id })
+	m.crew = slices.DeleteFunc(m.crew, func(c movieCrew) bool { return c.PersonID == id })
+	delete(m.people, id)
+
+	return nil
+}
+
+func (m *memory) UpdateMovie(ctx context.Context, id int, version int, title string, description string, release_date Date, rating int) error {
+	patch, ok := moviePatch(title, description, release_date, rating)
+	if !ok {
+		return ErrNoChanges
+	}
+	return m.PatchMovie(ctx, id, version, patch)
+}
+
+func (m *memory) UpdateActor(ctx context.Context, id int, version int, name string, gender string, birthday Date) error {
+	return m.UpdatePerson(ctx, id, version, name, gender, birthday, "")
+}
+
+func (m *memory) UpdatePerson(ctx context.Context, id int, version int, name, gender string, birthday Date, knownFor Department) error {
+	patch, ok := personPatch(name, gender, birthday, knownFor)
+	if !ok {
+		return ErrNoChanges
+	}
+	return m.PatchPerson(ctx, id, version, patch)
+}
+
+func (m *memory) PatchMovie(ctx context.Context, id int, version int, patch MoviePatch) error {
+	if patch.Rating.Set && (patch.Rating.Value < 0 || patch.Rating.Value > 10) {
+		return fmt.Errorf("unable to update row: %w", &kindError{kind: ErrValidation, msg: fmt.Sprintf("rating %d is out of range", patch.Rating.Value)})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := matchVersion(movie.Version, version); err != nil {
+		return err
+	}
+	if patch == (MoviePatch{}) {
+		return nil
+	}
+
+	if patch.Title.Set {
+		movie.Title = patch.Title.Value
+	}
+	if patch.Description.Set {
+		movie.Description = patch.Description.Value
+	}
+	if patch.Release_date.Set {
+		movie.Release_date = patch.Release_date.Value
+	}
+	if patch.Rating.Set {
+		movie.Rating = patch.Rating.Value
+	}
+	movie.Version++
+	m.movies[id] = movie
+	m.bumpCredited(id)
+
+	return nil
+}
+
+func (m *memory) PatchPerson(ctx context.Context, id int, version int, patch PersonPatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	person, ok := m.people[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := matchVersion(person.Version, version); err != nil {
+		return err
+	}
+	if patch == (PersonPatch{}) {
+		return nil
+	}
+
+	if patch.Name.Set {
+		person.Name = patch.Name.Value
+	}
+	if patch.Gender.Set {
+		person.Gender = patch.Gender.Value
+	}
+	if patch.Birthday.Set {
+		person.Birthday = patch.Birthday.Value
+	}
+	if patch.KnownFor.Set {
+		person.KnownFor = patch.KnownFor.Value
+	}
+	person.Version++
+	m.people[id] = person
+	m.bumpFilmography(id)
+
+	return nil
+}
+
+// matchVersion reports a version other than the current one, like
+// checkVersion in postgres. Version 0 matches any.
+func matchVersion(current, version int) error {
+	if version != 0 && version != current {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// bumpMovie, bumpPerson, bumpCast, bumpCredited, bumpFilmography and
+// bumpGenre raise
+// versions like their postgres counterparts. They must be called with m.mu
+// held.
+func (m *memory) bumpMovie(id int) {
+	if movie, ok := m.movies[id]; ok {
+		movie.Version++
+		m.movies[id] = movie
+	}
+}
+
+func (m *memory) bumpPerson(id int) {
+	if person, ok := m.people[id]; ok {
+		person.Version++
+		m.people[id] = person
+	}
+}
+
+func (m *memory) bumpCast(movieID int) {
+	m.bumpMovie(movieID)
+	m.bumpCredited(movieID)
+}
+
+func (m *memory) bumpCredited(movieID int) {
+	for _, personID := range m.credited(movieID) {
+		m.bumpPerson(personID)
+	}
+}
+
+func (m *memory) bumpFilmography(personID int) {
+	movies := make(map[int]bool)
+	for _, l := range m.links {
+		if l.actorID == personID {
+			movies[l.movieID] = true
+		}
+	}
+	for _, c := range m.crew {
+		if c.PersonID == personID {
+			movies[c.movieID] = true
+		}
+	}
+	for movieID := range movies {
+		m.bumpMovie(movieID)
+	}
+}
+
+func (m *memory) bumpGenre(genreID int) {
+	for movieID, genres := range m.movieGenres {
+		if slices.Contains(genres, genreID) {
+			m.bumpMovie(movieID)
+		}
+	}
+}
+
+// credited lists the people credited in the movie, once each.
+func (m *memory) credited(movieID int) []int {
+	var people []int
+	for _, l := range m.links {
+		if l.movieID == movieID {
+			people = append(people, l.actorID)
+		}
+	}
+	for _, c := range m.crew {
+		if c.movieID == movieID {
+			people = append(people, c.PersonID)
+		}
+	}
+	slices.Sort(people)
+	return slices.Compact(people)
+}
+
+// moviesInfo lists every movie filter keeps, with its cast, genres and crew. It must be called
+// with m.mu held, like actorNames and movieTitles.
+func (m *memory) moviesInfo(filter MovieFilter) []MovieInfo {
+	cast := make(map[int][]movieActor)
+	for _, l := range m.links {
+		cast[l.movieID] = append(cast[l.movieID], l)
+	}
+
+	moviesInfo := make([]MovieInfo, 0, len(m.movies))
+	for _, v := range m.movies {
+		movieInfo := MovieInfo{
+			ID:           v.ID,
+			Title:        v.Title,
+			Description:  v.Description,
+			Release_date: v.Release_date,
+			Rating:       v.Rating,
+			Actors:       m.actorNames(cast[v.ID]),
+			Genres:       m.genresOf(v.ID),
+			Crew:         m.crewOf(v.ID),
+		}
+		if filter.match(movieInfo) {
+			moviesInfo = append(moviesInfo, movieInfo)
+		}
+	}
+	return moviesInfo
+}
+
+// actorNames and movieTitles must be called with m.mu held. Both are ordered
+// by billing, then by ID, as in the postgres aggregation.
+func (m *memory) actorNames(cast []movieActor) []ActorName {
+	actorNames := make([]ActorName, 0, len(cast))
+	for _, l := range cast {
+		actorNames = append(actorNames, ActorName{ID: l.actorID, Name: m.people[l.actorID].Name, Part: l.Part})
+	}
+	sort.Slice(actorNames, func(i, j int) bool {
+		return creditLess(actorNames[i].Part, actorNames[j].Part, actorNames[i].ID, actorNames[j].ID)
+	})
+	return actorNames
+}
+
+func (m *memory) movieTitles(filmography []movieActor) []MovieTitle {
+	movieTitles := make([]MovieTitle, 0, len(filmography))
+	for _, l := range filmography {
+		movieTitles = append(movieTitles, MovieTitle{ID: l.movieID, Title: m.movies[l.movieID].Title, Part: l.Part})
+	}
+	sort.Slice(movieTitles, func(i, j int) bool {
+		return creditLess(movieTitles[i].Part, movieTitles[j].Part, movieTitles[i].ID, movieTitles[j].ID)
+	})
+	return movieTitles
+}
+
+func filterLinks(links []movieActor, keep func(movieActor) bool) []movieActor {
+	kept := links[:0]
+	for _, l := range links {
+		if keep(l) {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+func (m *memory) GetGenres(ctx context.Context) ([]GenreCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[int]int)
+	for _, genres := range m.movieGenres {
+		for _, id := range genres {
+			counts[id]++
+		}
+	}
+
+	genres := make([]GenreCount, 0, len(m.genres))
+	for _, v := range m.genres {
+		genres = append(genres, GenreCount{Genre: v, Count: counts[v.ID]})
+	}
+	sort.Slice(genres, func(i, j int) bool { return genres[i].Name < genres[j].Name })
+
+	return genres, nil
+}
+
+func (m *memory) GetGenre(ctx context.Context, id int) (Genre, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	genre, ok := m.genres[id]
+	if !ok {
+		return Genre{}, ErrNotFound
+	}
+	return genre, nil
+}
+
+func (m *memory) CreateGenre(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.genreExists(name, 0) {
+		return ErrGenreExists
+	}
+
+	m.nextGenreID++
+	m.genres[m.nextGenreID] = Genre{ID: m.nextGenreID, Name: name}
+
+	return nil
+}
+
+func (m *memory) UpdateGenre(ctx context.Context, id int, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.genres[id]; !ok {
+		return ErrNotFound
+	}
+	if m.genreExists(name, id) {
+		return ErrGenreExists
+	}
+	m.genres[id] = Genre{ID: id, Name: name}
+	m.bumpGenre(id)
+
+	return nil
+}
+
+func (m *memory) DeleteGenre(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bumpGenre(id)
+	for movieID, genres := range m.movieGenres {
+		m.movieGenres[movieID] = slices.DeleteFunc(genres, func(v int) bool { return v == id })
+	}
+	delete(m.genres, id)
+
+	return nil
+}
+
+func (m *memory) SetMovieGenres(ctx context.Context, movieID int, version int, genres []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkMovie(movieID, version); err != nil {
+		return err
+	}
+	genres = uniqueIDs(genres)
+	if err := m.checkGenres(genres); err != nil {
+		return err
+	}
+	m.movieGenres[movieID] = genres
+	m.bumpMovie(movieID)
+
+	return nil
+}
+
+// genreExists reports whether a genre other than except has the name, like
+// the unique index on lower(name). It must be called with m.mu held, like
+// checkGenres and genresOf.
+func (m *memory) genreExists(name string, except int) bool {
+	for _, v := range m.genres {
+		if v.ID != except && strings.EqualFold(v.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memory) checkGenres(genres []int) error {
+	found := make([]int, 0, len(genres))
+	for _, v := range genres {
+		if _, ok := m.genres[v]; ok {
+			found = append(found, v)
+		}
+	}
+	return missingGenres(genres, found)
+}
+
+// genresOf lists the genres of the movie by name, as genresSQL does.
+func (m *memory) genresOf(movieID int) []Genre {
+	genres := make([]Genre, 0, len(m.movieGenres[movieID]))
+	for _, id := range m.movieGenres[movieID] {
+		genres = append(genres, m.genres[id])
+	}
+	sort.Slice(genres, func(i, j int) bool { return genres[i].Name < genres[j].Name })
+	return genres
+}
+
+// genreFacet counts the genres of movies, most common first.
+func genreFacet(movies []MovieInfo) []GenreCount {
+	counts := make(map[Genre]int)
+	for _, v := range movies {
+		for _, g := range v.Genres {
+			counts[g]++
+		}
+	}
+
+	facet := make([]GenreCount, 0, len(counts))
+	for g, count := range counts {
+		facet = append(facet, GenreCount{Genre: g, Count: count})
+	}
+	sort.Slice(facet, func(i, j int) bool {
+		if facet[i].Count != facet[j].Count {
+			return facet[i].Count > facet[j].Count
+		}
+		return facet[i].Name < facet[j].Name
+	})
+	return facet
+}
+
+func (m *memory) GetPerson(ctx context.Context, id int) (PersonInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	person, ok := m.people[id]
+	if !ok {
+		return PersonInfo{}, ErrNotFound
+	}
+
+	var credits []departmentCredit
+	for _, l := range m.links {
+		if l.actorID == id {
+			credits = append(credits, m.departmentCredit(l.movieID, DepartmentActing, "", l.Part))
+		}
+	}
+	for _, c := range m.crew {
+		if c.PersonID == id {
+			credits = append(credits, m.departmentCredit(c.movieID, c.Department, c.Job, Part{}))
+		}
+	}
+
+	return PersonInfo{Person: person, Filmography: groupFilmography(credits)}, nil
+}
+
+func (m *memory) ReplaceMovieCrew(ctx context.Context, movieID int, version int, crew []CrewCredit) error {
+	crew, personIDs, err := checkCrew(crew)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkMovie(movieID, version); err != nil {
+		return err
+	}
+	found := make([]int, 0, len(personIDs))
+	for _, v := range personIDs {
+		if _, ok := m.people[v]; ok {
+			found = append(found, v)
+		}
+	}
+	if err := missingPeople(personIDs, found); err != nil {
+		return err
+	}
+
+	m.bumpCast(movieID)
+	m.crew = slices.DeleteFunc(m.crew, func(c movieCrew) bool { return c.movieID == movieID })
+	for _, c := range crew {
+		m.crew = append(m.crew, movieCrew{movieID: movieID, CrewCredit: c})
+	}
+	m.bumpCast(movieID)
+
+	return nil
+}
+
+// isActor reports whether the person is listed among the actors, as
+// actingSQL does.
+func isActor(person Person, filmography []movieActor) bool {
+	return person.KnownFor == DepartmentActing || len(filmography) > 0
+}
+
+// crewOf lists the crew of the movie in crewLess order, as crewSQL does. It
+// must be called with m.mu held, like departmentCredit.
+func (m *memory) crewOf(movieID int) []CrewMember {
+	crew := []CrewMember{}
+	for _, c := range m.crew {
+		if c.movieID == movieID {
+			crew = append(crew, CrewMember{
+				ID:         c.PersonID,
+				Name:       m.people[c.PersonID].Name,
+				Department: c.Department,
+				Job:        c.Job,
+			})
+		}
+	}
+	sort.Slice(crew, func(i, j int) bool { return crewLess(crew[i], crew[j]) })
+	return crew
+}
+
+func (m *memory) departmentCredit(movieID int, department Department, job string, part Part) departmentCredit {
+	movie := m.movies[movieID]
+	return departmentCredit{
+		Department: department,
+		FilmCredit: FilmCredit{
+			ID:           movie.ID,
+			Title:        movie.Title,
+			Release_date: movie.Release_date,
+			Job:          job,
+			Part:         part,
+		},
+	}
+}
+
+func (m *memory) GetUsers(ctx context.Context) ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]User, 0, len(m.users))
+	for _, v := range m.users {
+		users = append(users, v)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (m *memory) GetUser(ctx context.Context, id int) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *memory) GetUserByName(ctx context.Context, username string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, v := range m.users {
+		if strings.EqualFold(v.Username, username) {
+			return v, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (m *memory) CreateUser(ctx context.Context, username string, passwordHash []byte, role UserRole) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.users {
+		if strings.EqualFold(v.Username, username) {
+			return ErrUserExists
+		}
+	}
+
+	m.nextUserID++
+	m.users[m.nextUserID] = User{
+		ID:           m.nextUserID,
+		Username:     username,
+		Role:         role,
+		CreatedAt:    time.Now().UTC(),
+		PasswordHash: passwordHash,
+	}
+
+	return nil
+}
+
+func (m *memory) SetUserPassword(ctx context.Context, id int, passwordHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	m.users[id] = user
+
+	return nil
+}
+
+func (m *memory) SetUserDisabled(ctx context.Context, id int, disabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Disabled = disabled
+	m.users[id] = user
+
+	return nil
+}
+
+func (m *memory) SetUserRole(ctx context.Context, id int, role UserRole) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	m.users[id] = user
+
+	return nil
+}
+
+func (m *memory) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokens[token.Hash] = storedToken{RefreshToken: token}
+
+	return nil
+}
+
+func (m *memory) RotateRefreshToken(ctx context.Context, hash string, next RefreshToken) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[hash]
+	if !ok {
+		return RefreshToken{}, ErrInvalidToken
+	}
+	if token.revoked {
+		m.revokeFamily(token.Family)
+		return RefreshToken{}, ErrInvalidToken
+	}
+	if !token.ExpiresAt.After(time.Now()) {
+		return RefreshToken{}, ErrInvalidToken
+	}
+
+	token.revoked = true
+	m.tokens[hash] = token
+	next.UserID, next.Family = token.UserID, token.Family
+	m.tokens[next.Hash] = storedToken{RefreshToken: next}
+
+	return next, nil
+}
+
+func (m *memory) RevokeRefreshTokens(ctx context.Context, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if token, ok := m.tokens[hash]; ok {
+		m.revokeFamily(token.Family)
+	}
+
+	return nil
+}
+
+// revokeFamily must be called with m.mu held.
+func (m *memory) revokeFamily(family string) {
+	for hash, token := range m.tokens {
+		if token.Family == family {
+			token.revoked = true
+			m.tokens[hash] = token
+		}
+	}
+}
+
+func (m *memory) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for v, exp := range m.revoked {
+		if exp.Before(now) {
+			delete(m.revoked, v)
+		}
+	}
+	m.revoked[jti] = expiresAt
+
+	return nil
+}
+
+func (m *memory) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+func (m *memory) GetAPIKeys(ctx context.Context) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(m.apiKeys))
+	for _, v := range m.apiKeys {
+		keys = append(keys, v)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys, nil
+}
+
+func (m *memory) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, v := range m.apiKeys {
+		if v.Hash == hash {
+			return v, nil
+		}
+	}
+	return APIKey{}, ErrNotFound
+}
+
+func (m *memory) CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextKeyID++
+	key.ID = m.nextKeyID
+	key.Scopes = slices.Clone(key.Scopes)
+	key.CreatedAt = time.Now().UTC()
+	key.LastUsedAt = nil
+	m.apiKeys[key.ID] = key
+
+	return key, nil
+}
+
+func (m *memory) DeleteAPIKey(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.apiKeys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.apiKeys, id)
+
+	return nil
+}
+
+func (m *memory) TouchAPIKey(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now().UTC()
+	key.LastUsedAt = &now
+	m.apiKeys[id] = key
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package storage_test
+
+import (
+	"testing"
+
+	"vktest/src/storage"
+	"vktest/src/storage/storagetest"
+)
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) storage.Storage { return storage.NewMemStorage() })
+}
+
+func BenchmarkMemoryGetMovies(b *testing.B) {
+	s := storage.NewMemStorage()
+	storagetest.Seed(b, s, 10000, 2000, 5)
+	storagetest.BenchmarkGetMovies(b, s)
+}
+
+func BenchmarkMemoryGetActors(b *testing.B) {
+	s := storage.NewMemStorage()
+	storagetest.Seed(b, s, 10000, 2000, 5)
+	storagetest.BenchmarkGetActors(b, s)
+}
+
+func FuzzMemory(f *testing.F) {
+	storagetest.FuzzMutations(f, storage.NewMemStorage())
+}
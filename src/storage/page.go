@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor error = &kindError{kind: ErrValidation, msg: "invalid cursor"}
+
+// Page selects a window of a list. Limit 0 means no limit. After and Before
+// are cursors taken from a previous MoviesPage/ActorsPage; Offset is ignored
+// when one of them is set.
+type Page struct {
+	Limit  int
+	Offset int
+	After  string
+	Before string
+}
+
+// MoviesPage.Genres is a facet: the genres of all the movies that match the
+// filter, most common first.
+type MoviesPage struct {
+	Movies     []MovieInfo  `json:"movies"`
+	Total      int          `json:"total"`
+	Genres     []GenreCount `json:"genres"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+	PrevCursor string       `json:"prev_cursor,omitempty"`
+}
+
+type ActorsPage struct {
+	Actors     []ActorInfo `json:"actors"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
+}
+
+// cursor points at a row by its sort key values. ID breaks ties, so every
+// ordering ends with the row ID ascending.
+type cursor struct {
+	Values []any `json:"v"`
+	ID     int   `json:"id"`
+}
+
+func encodeCursor(values []any, id int) string {
+	data, _ := json.Marshal(cursor{Values: values, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, keys []SortKey, fields map[string]field) (cursor, error) {
+	var c cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil || len(c.Values) != len(keys) {
+		return c, ErrInvalidCursor
+	}
+
+	for i, key := range keys {
+		switch v := c.Values[i].(type) {
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil || !fields[key.Field].numeric {
+				return c, ErrInvalidCursor
+			}
+			c.Values[i] = int(n)
+		case string:
+			if fields[key.Field].numeric {
+				return c, ErrInvalidCursor
+			}
+			if fields[key.Field].date {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return c, ErrInvalidCursor
+				}
+				c.Values[i] = t
+			}
+		default:
+			return c, ErrInvalidCursor
+		}
+	}
+
+	return c, nil
+}
+
+// decode checks p and decodes whichever of After/Before is set. before
+// reports that the window lies before the cursor, so the backend has to scan
+// backwards.
+func (p Page) decode(keys []SortKey, fields map[string]field) (c *cursor, before bool, err error) {
+	if p.After != "" && p.Before != "" {
+		return nil, false, ErrInvalidCursor
+	}
+	if p.Limit < 0 || p.Offset < 0 {
+		return nil, false, fmt.Errorf("%w: limit and offset must not be negative", ErrValidation)
+	}
+
+	raw := p.After
+	if p.Before != "" {
+		raw, before = p.Before, true
+	}
+	if raw == "" {
+		return nil, false, nil
+	}
+
+	decoded, err := decodeCursor(raw, keys, fields)
+	if err != nil {
+		return nil, false, err
+	}
+	return &decoded, before, nil
+}
+
+// orderBy renders the ORDER BY list for keys, reversed when scanning
+// backwards from a Before cursor.
+func orderBy(keys []SortKey, fields map[string]field, idColumn string, reverse bool) string {
+	var parts []string
+	for _, key := range keys {
+		parts = append(parts, fields[key.Field].column+direction(key.Desc != reverse))
+	}
+	parts = append(parts, idColumn+direction(reverse))
+	return strings.Join(parts, ", ")
+}
+
+func direction(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+// keysetCondition renders the predicate selecting rows strictly past c in
+// scan order. Placeholders are numbered from len(args)+1 and their values
+// appended to args.
+func keysetCondition(keys []SortKey, fields map[string]field, idColumn string, c *cursor, reverse bool, args []any) (string, []any) {
+	columns := make([]string, 0, len(keys)+1)
+	descs := make([]bool, 0, len(keys)+1)
+	values := make([]any, 0, len(keys)+1)
+	for i, key := range keys {
+		columns = append(columns, fields[key.Field].column)
+		descs = append(descs, key.Desc)
+		values = append(values, c.Values[i])
+	}
+	columns = append(columns, idColumn)
+	descs = append(descs, false)
+	values = append(values, c.ID)
+
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		args = append(args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+
+	var alternatives []string
+	for i := range columns {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, columns[j]+" = "+placeholders[j])
+		}
+		op := " > "
+		if descs[i] != reverse {
+			op = " < "
+		}
+		terms = append(terms, columns[i]+op+placeholders[i])
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// finishPage turns the rows a backend fetched in scan order, including one
+// look-ahead row beyond the limit, into the page window and its cursors.
+func finishPage[T any](rows []T, p Page, c *cursor, before bool, encode func(T) string) (window []T, prev, next string) {
+	more := p.Limit > 0 && len(rows) > p.Limit
+	if more {
+		rows = rows[:p.Limit]
+	}
+	if before {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	if len(rows) == 0 {
+		return rows, "", ""
+	}
+
+	first, last := encode(rows[0]), encode(rows[len(rows)-1])
+	switch {
+	case before:
+		next = last
+		if more {
+			prev = first
+		}
+	default:
+		if more {
+			next = last
+		}
+		if c != nil || p.Offset > 0 {
+			prev = first
+		}
+	}
+
+	return rows, prev, next
+}
+
+// paginate is the in-memory counterpart of the keyset queries: it sorts
+// items, applies the cursor or offset and returns the rows in scan order with
+// one look-ahead row, ready for finishPage.
+func paginate[T any](items []T, keys []SortKey, p Page, c *cursor, before bool, value func(T, string) any, id func(T) int) []T {
+	compare := func(a, b T) int {
+		for _, key := range keys {
+			r := compareValues(value(a, key.Field), value(b, key.Field))
+			if key.Desc {
+				r = -r
+			}
+			if r != 0 {
+				return r
+			}
+		}
+		return id(a) - id(b)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if before {
+			return compare(items[i], items[j]) > 0
+		}
+		return compare(items[i], items[j]) < 0
+	})
+
+	if c != nil {
+		pastCursor := func(item T) bool {
+			for i, key := range keys {
+				r := compareValues(value(item, key.Field), c.Values[i])
+				if key.Desc {
+					r = -r
+				}
+				if r != 0 {
+					return (r > 0) != before
+				}
+			}
+			r := id(item) - c.ID
+			return r != 0 && (r > 0) != before
+		}
+		start := sort.Search(len(items), func(i int) bool { return pastCursor(items[i]) })
+		items = items[start:]
+	} else if p.Offset > 0 {
+		if p.Offset >= len(items) {
+			return items[len(items):]
+		}
+		items = items[p.Offset:]
+	}
+
+	if p.Limit > 0 && len(items) > p.Limit+1 {
+		items = items[:p.Limit+1]
+	}
+	return items
+}
+
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case int:
+		return a - b.(int)
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	return 0
+}
+
+func limitArg(p Page) any {
+	if p.Limit == 0 {
+		return nil
+	}
+	return p.Limit + 1
+}
+
+func offsetArg(p Page, c *cursor) int {
+	if c != nil {
+		return 0
+	}
+	return p.Offset
+}
+
+func movieValue(v MovieInfo, field string) any {
+	switch field {
+	case "id":
+		return v.ID
+	case "title":
+		return v.Title
+	case "release_date":
+		return v.Release_date.Start()
+	case "rating":
+		return v.Rating
+	case "actors":
+		return len(v.Actors)
+	}
+	return nil
+}
+
+func actorValue(v ActorInfo, field string) any {
+	switch field {
+	case "id":
+		return v.ID
+	case "name":
+		return v.Name
+	case "gender":
+		return v.Gender
+	case "birthday":
+		return v.Birthday.Start()
+	case "movies":
+		return len(v.Movies)
+	}
+	return nil
+}
+
+func searchValue(v MovieSearchResult, field string) any {
+	if field == "relevance" {
+		return v.Score
+	}
+	return movieValue(v.MovieInfo, field)
+}
+
+func sortValues[T any](v T, keys []SortKey, value func(T, string) any) []any {
+	values := make([]any, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, value(v, key.Field))
+	}
+	return values
+}
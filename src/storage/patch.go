@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Optional is a field of a JSON merge patch (RFC 7396). A field that is
+// absent is not Set and leaves the value as it is; null is Set and Null and
+// clears the value to the zero one; anything else sets it.
+type Optional[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+// Of returns an Optional that sets the value to v.
+func Of[T any](v T) Optional[T] {
+	return Optional[T]{Set: true, Value: v}
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	*o = Optional[T]{Set: true}
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// MoviePatch changes the fields of a movie that are Set. A cleared release
+// date is unknown.
+type MoviePatch struct {
+	Title        Optional[string] `json:"title"`
+	Description  Optional[string] `json:"description"`
+	Release_date Optional[Date]   `json:"release_date"`
+	Rating       Optional[int]    `json:"rating"`
+}
+
+// PersonPatch changes the fields of a person that are Set. A cleared
+// birthday is unknown.
+type PersonPatch struct {
+	Name     Optional[string]     `json:"name"`
+	Gender   Optional[string]     `json:"gender"`
+	Birthday Optional[Date]       `json:"birthday"`
+	KnownFor Optional[Department] `json:"known_for"`
+}
+
+// moviePatch is the patch of UpdateMovie, which leaves the fields that are
+// empty or 0 as they are. It reports false when no field is set.
+func moviePatch(title string, description string, release_date Date, rating int) (MoviePatch, bool) {
+	var patch MoviePatch
+	if title != "" {
+		patch.Title = Of(title)
+	}
+	if description != "" {
+		patch.Description = Of(description)
+	}
+	if !release_date.IsZero() {
+		patch.Release_date = Of(release_date)
+	}
+	if rating != 0 {
+		patch.Rating = Of(rating)
+	}
+	return patch, patch != MoviePatch{}
+}
+
+// personPatch is moviePatch for UpdatePerson.
+func personPatch(name, gender string, birthday Date, knownFor Department) (PersonPatch, bool) {
+	var patch PersonPatch
+	if name != "" {
+		patch.Name = Of(name)
+	}
+	if gender != "" {
+		patch.Gender = Of(gender)
+	}
+	if !birthday.IsZero() {
+		patch.Birthday = Of(birthday)
+	}
+	if knownFor != "" {
+		patch.KnownFor = Of(knownFor)
+	}
+	return patch, patch != PersonPatch{}
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Department is the part of the making of a movie a person works in. Acting
+// credits are the cast of a movie; the other departments are its crew.
+type Department string
+
+const (
+	DepartmentActing     Department = "acting"
+	DepartmentDirecting  Department = "directing"
+	DepartmentWriting    Department = "writing"
+	DepartmentProduction Department = "production"
+	DepartmentCamera     Department = "camera"
+	DepartmentEditing    Department = "editing"
+	DepartmentSound      Department = "sound"
+	DepartmentArt        Department = "art"
+)
+
+// departments is the order crews and filmographies are grouped in.
+var departments = []Department{
+	DepartmentActing, DepartmentDirecting, DepartmentWriting, DepartmentProduction,
+	DepartmentCamera, DepartmentEditing, DepartmentSound, DepartmentArt,
+}
+
+func (d Department) Valid() bool {
+	return slices.Contains(departments, d)
+}
+
+func (d *Department) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("department must be a string")
+	}
+	if s != "" && !Department(s).Valid() {
+		names := make([]string, len(departments))
+		for i, v := range departments {
+			names[i] = string(v)
+		}
+		return fmt.Errorf("unknown department %q, allowed departments: %s", s, strings.Join(names, ", "))
+	}
+	*d = Department(s)
+	return nil
+}
+
+// Person is anyone who worked on a movie. KnownFor is the department the
+// person is mainly known for; people known for acting are the actors, along
+// with everyone who has an acting credit.
+type Person struct {
+	ID       int        `json:"id"`
+	Name     string     `json:"name"`
+	Gender   string     `json:"gender"`
+	Birthday Date       `json:"birthday"`
+	KnownFor Department `json:"known_for"`
+	Version  int        `json:"-"`
+}
+
+type PersonInfo struct {
+	Person
+	Filmography []DepartmentCredits `json:"filmography"`
+}
+
+// DepartmentCredits are the movies a person worked on in one department,
+// newest first.
+type DepartmentCredits struct {
+	Department Department   `json:"department"`
+	Credits    []FilmCredit `json:"credits"`
+}
+
+// FilmCredit is a movie in a filmography. Acting credits carry the part, crew
+// credits the job.
+type FilmCredit struct {
+	ID           int    `json:"id"`
+	Title        string `json:"title"`
+	Release_date Date   `json:"release_date"`
+	Job          string `json:"job,omitempty"`
+	Part
+}
+
+// CrewCredit links a person to the crew of a movie. Job is free text, e.g.
+// "Director" or "Original Music Composer"; a person may have several jobs.
+type CrewCredit struct {
+	PersonID   int        `json:"person_id"`
+	Department Department `json:"department"`
+	Job        string     `json:"job,omitempty"`
+}
+
+// CrewMember is a crew credit of a movie, ordered by department, job and
+// person ID.
+type CrewMember struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Department Department `json:"department"`
+	Job        string     `json:"job,omitempty"`
+}
+
+// UnknownPeopleError reports person IDs that a movie crew was to include but
+// that do not exist.
+type UnknownPeopleError struct {
+	IDs []int
+}
+
+func (e *UnknownPeopleError) Error() string {
+	ids := make([]string, len(e.IDs))
+	for i, id := range e.IDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return fmt.Sprintf("unknown person ids: %s", strings.Join(ids, ", "))
+}
+
+func (e *UnknownPeopleError) Unwrap() error { return ErrValidation }
+
+func missingPeople(people []int, found []int) error {
+	if missing := missingIDs(people, found); len(missing) > 0 {
+		return &UnknownPeopleError{IDs: missing}
+	}
+	return nil
+}
+
+// checkCrew validates the credits and drops repeated ones. It returns the
+// credits and the IDs of their people.
+func checkCrew(crew []CrewCredit) ([]CrewCredit, []int, error) {
+	seen := make(map[CrewCredit]bool, len(crew))
+	unique := make([]CrewCredit, 0, len(crew))
+	ids := make([]int, 0, len(crew))
+	for _, c := range crew {
+		if c.Department == DepartmentActing {
+			return nil, nil, fmt.Errorf("%w: acting credits belong to the cast", ErrInvalidCredit)
+		}
+		if !c.Department.Valid() {
+			return nil, nil, fmt.Errorf("%w: unknown department %q", ErrInvalidCredit, c.Department)
+		}
+		if !seen[c] {
+			seen[c] = true
+			unique = append(unique, c)
+			ids = append(ids, c.PersonID)
+		}
+	}
+	return unique, uniqueIDs(ids), nil
+}
+
+func crewLess(a, b CrewMember) bool {
+	if a.Department != b.Department {
+		return slices.Index(departments, a.Department) < slices.Index(departments, b.Department)
+	}
+	if a.Job != b.Job {
+		return a.Job < b.Job
+	}
+	return a.ID < b.ID
+}
+
+// departmentOrderSQL sorts column the way crewLess sorts departments.
+func departmentOrderSQL(column string) string {
+	names := make([]string, len(departments))
+	for i, v := range departments {
+		names[i] = "'" + string(v) + "'"
+	}
+	return fmt.Sprintf("array_position(ARRAY[%s], %s::text)", strings.Join(names, ", "), column)
+}
+
+// crewSQL lists the crew of the movie of the current row as JSON that scans
+// into []CrewMember.
+var crewSQL = `(SELECT COALESCE(json_agg(json_build_object(
+			'id', person.id, 'name', person.name, 'department', movie_crew.department, 'job', movie_crew.job
+		) ORDER BY ` + departmentOrderSQL("movie_crew.department") + `, movie_crew.job, person.id), '[]')
+		FROM movie_crew
+		JOIN person ON person.id = movie_crew.person_id
+		WHERE movie_crew.movie_id = movie.id)`
+
+// actingSQL keeps the people of an actor query who are actors.
+const actingSQL = `(actor.known_for = 'acting'
+		OR EXISTS (SELECT 1 FROM movie_actor AS credit WHERE credit.actor_id = actor.id))`
+
+// departmentCredit is a FilmCredit with its department, as read from
+// storage, before the filmography is grouped.
+type departmentCredit struct {
+	Department Department
+	FilmCredit
+}
+
+// groupFilmography groups credits by department in the departments order,
+// newest movies first and movies without a release date last.
+func groupFilmography(credits []departmentCredit) []DepartmentCredits {
+	sort.SliceStable(credits, func(i, j int) bool {
+		a, b := credits[i].FilmCredit, credits[j].FilmCredit
+		if a.Release_date.IsZero() != b.Release_date.IsZero() {
+			return b.Release_date.IsZero()
+		}
+		if !a.Release_date.Start().Equal(b.Release_date.Start()) {
+			return a.Release_date.Start().After(b.Release_date.Start())
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Job < b.Job
+	})
+
+	filmography := []DepartmentCredits{}
+	for _, department := range departments {
+		group := DepartmentCredits{Department: department, Credits: []FilmCredit{}}
+		for _, c := range credits {
+			if c.Department == department {
+				group.Credits = append(group.Credits, c.FilmCredit)
+			}
+		}
+		if len(group.Credits) > 0 {
+			filmography = append(filmography, group)
+		}
+	}
+	return filmography
+}
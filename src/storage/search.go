@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Thresholds of the pg_trgm % and <% operators, mirrored by the in-memory
+// backend.
+const (
+	similarityThreshold     = 0.3
+	wordSimilarityThreshold = 0.6
+)
+
+type MovieSearchResult struct {
+	MovieInfo
+	Score      float64  `json:"score"`
+	Highlights []string `json:"highlights"`
+}
+
+// SearchPage is a page of search results. Search is paged by limit/offset
+// only, so it carries no cursors.
+type SearchPage struct {
+	Results []MovieSearchResult `json:"results"`
+	Total   int                 `json:"total"`
+}
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// fold lower-cases s and treats ё as е, so that Cyrillic and Latin input is
+// compared case-insensitively. foldSQL is the same expression for postgres.
+func fold(s string) string {
+	return strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+}
+
+func foldSQL(expr string) string {
+	return "translate(lower(" + expr + "), 'ё', 'е')"
+}
+
+// likeContains is the LIKE pattern that matches text containing expr, with
+// the wildcards of expr escaped. Unlike strpos, LIKE can use a trigram index.
+func likeContains(expr string) string {
+	return `('%' || replace(replace(replace(` + expr + `, '\', '\\'), '%', '\%'), '_', '\_') || '%')`
+}
+
+// highlightMovie returns the title, actor names and description fragment in
+// which a query word was found, HTML-escaped with the matches wrapped in
+// <mark>.
+func highlightMovie(m MovieInfo, search string) []string {
+	words := wordPattern.FindAllString(fold(search), -1)
+
+	highlights := []string{}
+	if marked, ok := markWords(m.Title, words); ok {
+		highlights = append(highlights, marked)
+	}
+	for _, a := range m.Actors {
+		if marked, ok := markWords(a.Name, words); ok {
+			highlights = append(highlights, marked)
+		}
+	}
+	if marked, ok := markWords(m.Description, words); ok {
+		highlights = append(highlights, fragment(marked, 8))
+	}
+	return highlights
+}
+
+// markWords wraps the words of text that match one of words in <mark>. The
+// rest of text is HTML-escaped, so that clients can render highlights as HTML.
+func markWords(text string, words []string) (string, bool) {
+	var b strings.Builder
+	found := false
+	last := 0
+	for _, loc := range wordPattern.FindAllStringIndex(text, -1) {
+		w := text[loc[0]:loc[1]]
+		fw := fold(w)
+		for _, q := range words {
+			if strings.Contains(fw, q) || wordSimilarity(q, fw) >= wordSimilarityThreshold {
+				found = true
+				b.WriteString(html.EscapeString(text[last:loc[0]]))
+				b.WriteString("<mark>" + html.EscapeString(w) + "</mark>")
+				last = loc[1]
+				break
+			}
+		}
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String(), found
+}
+
+// fragment cuts marked text down to radius words around the first match.
+func fragment(marked string, radius int) string {
+	words := strings.Fields(marked)
+	first := 0
+	for i, w := range words {
+		if strings.Contains(w, "<mark>") {
+			first = i
+			break
+		}
+	}
+
+	start, end := first-radius, first+radius+1
+	prefix, suffix := "…", "…"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(words) {
+		end, suffix = len(words), ""
+	}
+	return prefix + strings.Join(words[start:end], " ") + suffix
+}
+
+// trigrams splits s into pg_trgm trigrams: every word is padded with two
+// spaces in front and one behind.
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, w := range wordPattern.FindAllString(fold(s), -1) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			set[string(r[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+// similarity matches pg_trgm similarity(a, b).
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	common := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// wordSimilarity approximates pg_trgm word_similarity(q, text): the share of
+// q's trigrams found in the best run of consecutive words of text.
+func wordSimilarity(q, text string) float64 {
+	tq := trigrams(q)
+	words := wordPattern.FindAllString(text, -1)
+	if len(tq) == 0 || len(words) == 0 {
+		return 0
+	}
+
+	span := len(wordPattern.FindAllString(q, -1))
+	if span > len(words) {
+		span = len(words)
+	}
+
+	best := 0.0
+	for i := 0; i+span <= len(words); i++ {
+		tw := trigrams(strings.Join(words[i:i+span], " "))
+		common := 0
+		for t := range tq {
+			if _, ok := tw[t]; ok {
+				common++
+			}
+		}
+		if s := float64(common) / float64(len(tq)); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// ftsRank stands in for ts_rank of a single full-text hit in the in-memory
+// backend.
+const ftsRank = 0.06
+
+// matchMovie is the in-memory version of the postgres search predicate and
+// score: full-text on title and description, trigram similarity on the title
+// and word similarity on actor names, plus plain substring matches.
+func matchMovie(m MovieInfo, search string) (float64, bool) {
+	q := fold(search)
+	title := fold(m.Title)
+
+	score := 0.0
+	matched := false
+	consider := func(s, threshold float64) {
+		if s > score {
+			score = s
+		}
+		if s >= threshold {
+			matched = true
+		}
+	}
+
+	doc := make(map[string]bool)
+	for _, w := range wordPattern.FindAllString(title+" "+fold(m.Description), -1) {
+		doc[w] = true
+	}
+	words := wordPattern.FindAllString(q, -1)
+	fts := len(words) > 0
+	for _, w := range words {
+		fts = fts && doc[w]
+	}
+	if fts {
+		consider(ftsRank, 0)
+	}
+
+	consider(similarity(q, title), similarityThreshold)
+	consider(wordSimilarity(q, title), wordSimilarityThreshold)
+	if strings.Contains(title, q) {
+		matched = true
+	}
+
+	for _, a := range m.Actors {
+		name := fold(a.Name)
+		consider(wordSimilarity(q, name), wordSimilarityThreshold)
+		if strings.Contains(name, q) {
+			matched = true
+		}
+	}
+
+	return score, matched
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortKey orders a list by one field. Lists are ordered by their keys in
+// turn and then by ID.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// SortError reports a sort field the list does not support.
+type SortError struct {
+	Field   string
+	Allowed []string
+}
+
+func (e *SortError) Error() string {
+	return fmt.Sprintf("unknown sort field %q, allowed fields: %s", e.Field, strings.Join(e.Allowed, ", "))
+}
+
+// ParseSort reads a comma-separated sort expression such as "-rating,title".
+// A leading "-" sorts the field in descending order, a leading "+" or none in
+// ascending order. Field names are checked by the storage methods.
+func ParseSort(expr string) []SortKey {
+	if strings.TrimSpace(expr) == "" {
+		return nil
+	}
+
+	var keys []SortKey
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+
+		var key SortKey
+		switch {
+		case strings.HasPrefix(part, "-"):
+			key.Desc = true
+			part = part[1:]
+		case strings.HasPrefix(part, "+"):
+			part = part[1:]
+		}
+		key.Field = strings.ToLower(part)
+
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// field is a sortable column. Missing dates sort as the zero time.Time, so
+// date columns are coalesced to its SQL counterpart.
+type field struct {
+	column  string
+	numeric bool
+	date    bool
+}
+
+var movieFields = map[string]field{
+	"id":           {column: "movie.id", numeric: true},
+	"title":        {column: "movie.title"},
+	"release_date": {column: "COALESCE(movie.release_date, DATE '0001-01-01')", date: true},
+	"rating":       {column: "movie.rating", numeric: true},
+	"actors":       {column: "movie.actor_count", numeric: true},
+}
+
+var actorFields = map[string]field{
+	"id":       {column: "actor.id", numeric: true},
+	"name":     {column: "actor.name"},
+	"gender":   {column: "actor.gender"},
+	"birthday": {column: "COALESCE(actor.birthday, DATE '0001-01-01')", date: true},
+	"movies":   {column: "actor.movie_count", numeric: true},
+}
+
+// searchFields adds the relevance score to movieFields. Search results are
+// ranked by it unless another order is requested.
+var searchFields = func() map[string]field {
+	fields := map[string]field{"relevance": {column: "movie.score"}}
+	for name, f := range movieFields {
+		fields[name] = f
+	}
+	return fields
+}()
+
+func checkSort(keys []SortKey, fields map[string]field) error {
+	for _, key := range keys {
+		if _, ok := fields[key.Field]; !ok {
+			allowed := make([]string, 0, len(fields))
+			for name := range fields {
+				allowed = append(allowed, name)
+			}
+			sort.Strings(allowed)
+			return &SortError{Field: key.Field, Allowed: allowed}
+		}
+	}
+	return nil
+}
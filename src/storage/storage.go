@@ -2,10 +2,16 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -13,71 +19,294 @@ type Movie struct {
 	ID           int    `json:"id"`
 	Title        string `json:"title"`
 	Description  string `json:"description"`
-	Release_date string `json:"release_date"`
+	Release_date Date   `json:"release_date"`
 	Rating       int    `json:"rating"`
+	Version      int    `json:"-"`
 }
 
 type Actor struct {
 	ID       int    `json:"id"`
 	Name     string `json:"name"`
 	Gender   string `json:"gender"`
-	Birthday string `json:"birthday"`
+	Birthday Date   `json:"birthday"`
 }
 
 type MovieTitle struct {
+	ID    int    `json:"id"`
 	Title string `json:"title"`
+	Part
 }
 
 type ActorName struct {
+	ID   int    `json:"id"`
 	Name string `json:"name"`
+	Part
 }
 
 type MovieInfo struct {
-	ID           int         `json:"id"`
-	Title        string      `json:"title"`
-	Description  string      `json:"description"`
-	Release_date string      `json:"release_date"`
-	Rating       int         `json:"rating"`
-	Actors       []ActorName `json:"actors"`
+	ID           int          `json:"id"`
+	Title        string       `json:"title"`
+	Description  string       `json:"description"`
+	Release_date Date         `json:"release_date"`
+	Rating       int          `json:"rating"`
+	Actors       []ActorName  `json:"actors"`
+	Genres       []Genre      `json:"genres"`
+	Crew         []CrewMember `json:"crew"`
+	Version      int          `json:"-"`
 }
 
 type ActorInfo struct {
 	ID       int          `json:"id"`
 	Name     string       `json:"name"`
 	Gender   string       `json:"gender"`
-	Birthday string       `json:"birthday"`
+	Birthday Date         `json:"birthday"`
 	Movies   []MovieTitle `json:"movies"`
+	Version  int          `json:"-"`
+}
+
+// ErrNotFound, ErrConflict and ErrValidation are the kinds of storage
+// errors that are the caller's doing: a missing row, a clash with another
+// row, and data the storage does not accept. The more specific errors wrap
+// one of them.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+)
+
+// ErrUnavailable is the kind of the errors of a database that cannot be
+// reached. They are not the caller's doing, and as the pool reconnects on its
+// own, the same call may succeed later.
+var ErrUnavailable = errors.New("storage unavailable")
+
+// kindError is a specific error of one of the kinds above.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string { return e.msg }
+func (e *kindError) Unwrap() error { return e.kind }
+
+// ErrVersionMismatch is returned by the changes of a movie or person that
+// were made against a version other than the current one.
+var ErrVersionMismatch error = &kindError{kind: ErrConflict, msg: "version mismatch"}
+
+// ErrNoChanges is returned by the updates when no field is set.
+var ErrNoChanges error = &kindError{kind: ErrValidation, msg: "fields to change must be specified"}
+
+// constraintError is a constraint violation of the database, which names the
+// constraint rather than quoting the database.
+type constraintError struct {
+	kind error
+	err  *pgconn.PgError
+}
+
+func (e *constraintError) Error() string {
+	if e.err.ConstraintName != "" {
+		return fmt.Sprintf("%s: violates %s", e.kind, e.err.ConstraintName)
+	}
+	return fmt.Sprintf("%s: %s", e.kind, e.err.Message)
+}
+
+func (e *constraintError) Unwrap() error { return e.kind }
+
+// unavailableError is an ErrUnavailable with the error of the connection.
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string   { return fmt.Sprintf("%s: %s", ErrUnavailable, e.err) }
+func (e *unavailableError) Unwrap() []error { return []error{ErrUnavailable, e.err} }
+
+// classify turns constraint violations and rejected values into ErrConflict
+// and ErrValidation errors, and failed connections into ErrUnavailable ones.
+// Other errors are returned as they are.
+func classify(err error) error {
+	if unreachable(err) {
+		return &unavailableError{err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case "23505": // unique_violation
+		return &constraintError{kind: ErrConflict, err: pgErr}
+	case "23502", "23503", "23514", // not_null, foreign_key and check violations
+		"22001", "22003", "22007", "22008": // string too long, numeric out of range, bad dates
+		return &constraintError{kind: ErrValidation, err: pgErr}
+	}
+	return err
+}
+
+// unreachable reports whether err is of the connection to the database
+// rather than of the statement.
+func unreachable(err error) bool {
+	if err == nil || errors.Is(err, ErrUnavailable) {
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connectErr) || errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Connection exceptions, and a server that is shutting down or
+		// starting up.
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	return false
+}
+
+// inTx runs fn in a transaction like pgx.BeginFunc. A transaction that cannot
+// begin or commit for want of a connection is ErrUnavailable.
+func (pg *postgres) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	err := pgx.BeginFunc(ctx, pg.db, fn)
+	if unreachable(err) {
+		return &unavailableError{err: err}
+	}
+	return err
+}
+
+// UnknownActorsError reports actor IDs that a movie was to be linked to but
+// that do not exist.
+type UnknownActorsError struct {
+	IDs []int
+}
+
+func (e *UnknownActorsError) Error() string {
+	ids := make([]string, len(e.IDs))
+	for i, id := range e.IDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return fmt.Sprintf("unknown actor ids: %s", strings.Join(ids, ", "))
+}
+
+func (e *UnknownActorsError) Unwrap() error { return ErrValidation }
+
+// missingActors returns an UnknownActorsError for the IDs in actors that are
+// not in found, or nil. missingGenres does the same for genres.
+func missingActors(actors []int, found []int) error {
+	if missing := missingIDs(actors, found); len(missing) > 0 {
+		return &UnknownActorsError{IDs: missing}
+	}
+	return nil
+}
+
+func missingGenres(genres []int, found []int) error {
+	if missing := missingIDs(genres, found); len(missing) > 0 {
+		return &UnknownGenresError{IDs: missing}
+	}
+	return nil
+}
+
+func missingIDs(ids []int, found []int) []int {
+	exists := make(map[int]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+
+	var missing []int
+	for _, id := range ids {
+		if !exists[id] {
+			exists[id] = true
+			missing = append(missing, id)
+		}
+	}
+	return missing
 }
 
 type Storage interface {
-	GetMovies(ctx context.Context, sortField string) ([]MovieInfo, error)
-	GetActors(ctx context.Context) ([]ActorInfo, error)
-	CreateMovie(ctx context.Context, title string, description string, release_date string, rating int, actors []int) error
-	CreateActor(ctx context.Context, name, gender, birthday string) error
-	DeleteMovie(ctx context.Context, id int) error
-	DeleteActor(ctx context.Context, id int) error
-	UpdateMovie(ctx context.Context, id int, title string, description string, release_date string, rating int) error
-	UpdateActor(ctx context.Context, id int, name string, gender string, birthday string) error
+	// Ping checks that the storage can be reached.
+	Ping(ctx context.Context) error
+	GetMovies(ctx context.Context, filter MovieFilter, sort []SortKey, page Page) (MoviesPage, error)
+	GetActors(ctx context.Context, filter ActorFilter, sort []SortKey, page Page) (ActorsPage, error)
+	GetMovie(ctx context.Context, id int) (MovieInfo, error)
+	GetActor(ctx context.Context, id int) (ActorInfo, error)
+	SearchMovies(ctx context.Context, search string, filter MovieFilter, sort []SortKey, page Page) (SearchPage, error)
+	CreateMovie(ctx context.Context, title string, description string, release_date Date, rating int, actors []Credit, genres []int) error
+	CreateActor(ctx context.Context, name, gender string, birthday Date) error
+	AddMovieActors(ctx context.Context, movieID int, version int, actors []Credit) error
+	RemoveMovieActors(ctx context.Context, movieID int, version int, actors []int) error
+	ReplaceMovieActors(ctx context.Context, movieID int, version int, actors []Credit) error
+	DeleteMovie(ctx context.Context, id int, version int) error
+	DeleteActor(ctx context.Context, id int, version int) error
+	UpdateMovie(ctx context.Context, id int, version int, title string, description string, release_date Date, rating int) error
+	UpdateActor(ctx context.Context, id int, version int, name string, gender string, birthday Date) error
+	PatchMovie(ctx context.Context, id int, version int, patch MoviePatch) error
+	GetGenres(ctx context.Context) ([]GenreCount, error)
+	GetGenre(ctx context.Context, id int) (Genre, error)
+	CreateGenre(ctx context.Context, name string) error
+	UpdateGenre(ctx context.Context, id int, name string) error
+	DeleteGenre(ctx context.Context, id int) error
+	SetMovieGenres(ctx context.Context, movieID int, version int, genres []int) error
+	GetPerson(ctx context.Context, id int) (PersonInfo, error)
+	CreatePerson(ctx context.Context, name, gender string, birthday Date, knownFor Department) error
+	UpdatePerson(ctx context.Context, id int, version int, name, gender string, birthday Date, knownFor Department) error
+	PatchPerson(ctx context.Context, id int, version int, patch PersonPatch) error
+	DeletePerson(ctx context.Context, id int, version int) error
+	ReplaceMovieCrew(ctx context.Context, movieID int, version int, crew []CrewCredit) error
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUser(ctx context.Context, id int) (User, error)
+	GetUserByName(ctx context.Context, username string) (User, error)
+	CreateUser(ctx context.Context, username string, passwordHash []byte, role UserRole) error
+	SetUserPassword(ctx context.Context, id int, passwordHash []byte) error
+	SetUserDisabled(ctx context.Context, id int, disabled bool) error
+	SetUserRole(ctx context.Context, id int, role UserRole) error
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	RotateRefreshToken(ctx context.Context, hash string, next RefreshToken) (RefreshToken, error)
+	RevokeRefreshTokens(ctx context.Context, hash string) error
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	AccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	GetAPIKeys(ctx context.Context) ([]APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error)
+	DeleteAPIKey(ctx context.Context, id int) error
+	TouchAPIKey(ctx context.Context, id int) error
 }
 
+// castSQL and filmographySQL aggregate the credits of the movie or actor of
+// a grouped row into JSON that scans into []ActorName or []MovieTitle, in
+// billing order.
+const (
+	castSQL = `COALESCE(json_agg(json_build_object(
+			'id', actor.id, 'name', actor.name, 'character', movie_actor.character_name,
+			'billing', movie_actor.billing, 'role', movie_actor.role
+		) ORDER BY movie_actor.billing = 0, movie_actor.billing, actor.id) FILTER (WHERE actor.id IS NOT NULL), '[]')`
+	filmographySQL = `COALESCE(json_agg(json_build_object(
+			'id', movie.id, 'title', movie.title, 'character', movie_actor.character_name,
+			'billing', movie_actor.billing, 'role', movie_actor.role
+		) ORDER BY movie_actor.billing = 0, movie_actor.billing, movie.id) FILTER (WHERE movie.id IS NOT NULL), '[]')`
+)
+
 type postgres struct {
 	db *pgxpool.Pool
 }
 
-func NewPgStorage(ctx context.Context, connString string) (*postgres, error) {
-	var pgInstance *postgres
-	var pgOnce sync.Once
-	pgOnce.Do(func() {
-		db, err := pgxpool.New(ctx, connString)
-		if err != nil {
-			fmt.Printf("Unable to create connection pool: %v\n", err)
-			return
-		}
-
-		pgInstance = &postgres{db}
-	})
+// NewPgStorage connects to connString with a pool of minConns to maxConns
+// connections.
+func NewPgStorage(ctx context.Context, connString string, maxConns, minConns int32) (*postgres, error) {
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse connection string: %w", err)
+	}
+	config.MaxConns = maxConns
+	config.MinConns = minConns
+	return newPgStorage(ctx, config)
+}
 
-	return pgInstance, nil
+func newPgStorage(ctx context.Context, config *pgxpool.Config) (*postgres, error) {
+	// The pool connects lazily, so this does not need the database yet.
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+	return &postgres{db}, nil
 }
 
 func (pg *postgres) Ping(ctx context.Context) error {
@@ -88,253 +317,1269 @@ func (pg *postgres) Close() {
 	pg.db.Close()
 }
 
-func (pg *postgres) GetMovies(ctx context.Context, sortField string) ([]MovieInfo, error) {
-	query := fmt.Sprintf(`SELECT id, title, description, release_date, rating FROM movie ORDER BY %s`, sortField)
+func (pg *postgres) GetMovies(ctx context.Context, filter MovieFilter, sort []SortKey, page Page) (MoviesPage, error) {
+	var moviesPage MoviesPage
 
-	rows, err := pg.db.Query(ctx, query)
+	if err := checkSort(sort, movieFields); err != nil {
+		return moviesPage, err
+	}
+	c, before, err := page.decode(sort, movieFields)
+	if err != nil {
+		return moviesPage, err
+	}
 
-	var movies []Movie
-	var moviesInfo []MovieInfo
+	filterConditions, args := filter.conditions(nil)
+	err = pg.db.QueryRow(ctx, `SELECT count(*) FROM movie `+whereClause(filterConditions), args...).Scan(&moviesPage.Total)
+	if err != nil {
+		return moviesPage, fmt.Errorf("unable to query: %w", classify(err))
+	}
 
+	rows, err := pg.db.Query(ctx, `SELECT genre.id, genre.name, count(*)
+	FROM movie_genre
+	JOIN genre ON genre.id = movie_genre.genre_id
+	WHERE movie_genre.movie_id IN (SELECT movie.id FROM movie `+whereClause(filterConditions)+`)
+	GROUP BY genre.id
+	ORDER BY count(*) DESC, genre.name`, args...)
+	if err != nil {
+		return moviesPage, fmt.Errorf("unable to query: %w", classify(err))
+	}
+	moviesPage.Genres, err = pgx.CollectRows(rows, scanGenreCount)
+	if err != nil {
+		return moviesPage, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	var keyset []string
+	if c != nil {
+		var condition string
+		condition, args = keysetCondition(sort, movieFields, "movie.id", c, before, args)
+		keyset = append(keyset, condition)
+	}
+	args = append(args, limitArg(page), offsetArg(page, c))
+
+	query := fmt.Sprintf(`SELECT movie.id, movie.title, movie.description, movie.release_date, movie.release_date_precision,
+		movie.rating, movie.actors, movie.genres, movie.crew
+	FROM (
+		SELECT movie.id, movie.title, movie.description, movie.release_date, movie.release_date_precision, movie.rating,
+			%s AS actors,
+			%s AS genres,
+			%s AS crew,
+			count(actor.id) AS actor_count
+		FROM movie
+		LEFT JOIN movie_actor ON movie_actor.movie_id = movie.id
+		LEFT JOIN person AS actor ON actor.id = movie_actor.actor_id
+		%s
+		GROUP BY movie.id
+	) AS movie
+	%s
+	ORDER BY %s
+	LIMIT $%d OFFSET $%d`, castSQL, genresSQL, crewSQL, whereClause(filterConditions), whereClause(keyset),
+		orderBy(sort, movieFields, "movie.id", before), len(args)-1, len(args))
+
+	rows, err = pg.db.Query(ctx, query, args...)
 	if err != nil {
-		return moviesInfo, fmt.Errorf("unable to query: %w", err)
+		return moviesPage, fmt.Errorf("unable to query: %w", classify(err))
 	}
 	defer rows.Close()
 
-	movies, err = pgx.CollectRows(rows, pgx.RowToStructByName[Movie])
+	moviesInfo, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (MovieInfo, error) {
+		return scanMovie(row)
+	})
 	if err != nil {
-		fmt.Printf("CollectRows error: %v", err)
-		return moviesInfo, err
+		return moviesPage, fmt.Errorf("unable to query: %w", classify(err))
 	}
 
-	for _, v := range movies {
-		query = fmt.Sprintf(`SELECT actor.name from actor, movie_actor
-		WHERE movie_actor.movie_id = %d and actor.id = movie_actor.actor_id;`, v.ID)
+	moviesPage.Movies, moviesPage.PrevCursor, moviesPage.NextCursor = finishPage(moviesInfo, page, c, before,
+		func(v MovieInfo) string { return encodeCursor(sortValues(v, sort, movieValue), v.ID) })
 
-		rows, err := pg.db.Query(ctx, query)
+	return moviesPage, nil
+}
 
-		var actorNames []ActorName
-		var movieInfo MovieInfo
+func (pg *postgres) GetActors(ctx context.Context, filter ActorFilter, sort []SortKey, page Page) (ActorsPage, error) {
+	var actorsPage ActorsPage
 
-		if err != nil {
-			return moviesInfo, fmt.Errorf("unable to query: %w", err)
-		}
-		defer rows.Close()
+	if err := checkSort(sort, actorFields); err != nil {
+		return actorsPage, err
+	}
+	c, before, err := page.decode(sort, actorFields)
+	if err != nil {
+		return actorsPage, err
+	}
 
-		actorNames, err = pgx.CollectRows(rows, pgx.RowToStructByName[ActorName])
-		if err != nil {
-			fmt.Printf("CollectRows error: %v", err)
-			return moviesInfo, err
-		}
+	filterConditions, args := filter.conditions(nil)
+	filterConditions = append([]string{actingSQL}, filterConditions...)
+	err = pg.db.QueryRow(ctx, `SELECT count(*) FROM person AS actor `+whereClause(filterConditions), args...).Scan(&actorsPage.Total)
+	if err != nil {
+		return actorsPage, fmt.Errorf("unable to query: %w", classify(err))
+	}
 
-		movieInfo.ID = v.ID
-		movieInfo.Title = v.Title
-		movieInfo.Description = v.Description
-		movieInfo.Release_date = v.Release_date
-		movieInfo.Rating = v.Rating
-		movieInfo.Actors = actorNames
+	var keyset []string
+	if c != nil {
+		var condition string
+		condition, args = keysetCondition(sort, actorFields, "actor.id", c, before, args)
+		keyset = append(keyset, condition)
+	}
+	args = append(args, limitArg(page), offsetArg(page, c))
+
+	query := fmt.Sprintf(`SELECT actor.id, actor.name, actor.gender, actor.birthday, actor.birthday_precision,
+		actor.movies
+	FROM (
+		SELECT actor.id, actor.name, actor.gender, actor.birthday, actor.birthday_precision,
+			%s AS movies,
+			count(movie.id) AS movie_count
+		FROM person AS actor
+		LEFT JOIN movie_actor ON movie_actor.actor_id = actor.id
+		LEFT JOIN movie ON movie.id = movie_actor.movie_id
+		%s
+		GROUP BY actor.id
+	) AS actor
+	%s
+	ORDER BY %s
+	LIMIT $%d OFFSET $%d`, filmographySQL, whereClause(filterConditions), whereClause(keyset),
+		orderBy(sort, actorFields, "actor.id", before), len(args)-1, len(args))
+
+	rows, err := pg.db.Query(ctx, query, args...)
+	if err != nil {
+		return actorsPage, fmt.Errorf("unable to query: %w", classify(err))
+	}
+	defer rows.Close()
 
-		moviesInfo = append(moviesInfo, movieInfo)
+	actorsInfo, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ActorInfo, error) {
+		return scanActor(row)
+	})
+	if err != nil {
+		return actorsPage, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	actorsPage.Actors, actorsPage.PrevCursor, actorsPage.NextCursor = finishPage(actorsInfo, page, c, before,
+		func(v ActorInfo) string { return encodeCursor(sortValues(v, sort, actorValue), v.ID) })
+
+	return actorsPage, nil
+}
+
+func (pg *postgres) GetMovie(ctx context.Context, id int) (MovieInfo, error) {
+	row := pg.db.QueryRow(ctx, `SELECT movie.id, movie.title, movie.description, movie.release_date, movie.release_date_precision,
+		movie.rating, `+castSQL+`, `+genresSQL+`, `+crewSQL+`, movie.version
+	FROM movie
+	LEFT JOIN movie_actor ON movie_actor.movie_id = movie.id
+	LEFT JOIN person AS actor ON actor.id = movie_actor.actor_id
+	WHERE movie.id = $1
+	GROUP BY movie.id`, id)
+
+	var version int
+	movieInfo, err := scanMovie(row, &version)
+	movieInfo.Version = version
+	if errors.Is(err, pgx.ErrNoRows) {
+		return movieInfo, ErrNotFound
+	}
+	if err != nil {
+		return movieInfo, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	return movieInfo, nil
+}
+
+func (pg *postgres) GetActor(ctx context.Context, id int) (ActorInfo, error) {
+	row := pg.db.QueryRow(ctx, `SELECT actor.id, actor.name, actor.gender, actor.birthday, actor.birthday_precision,
+		`+filmographySQL+`, actor.version
+	FROM person AS actor
+	LEFT JOIN movie_actor ON movie_actor.actor_id = actor.id
+	LEFT JOIN movie ON movie.id = movie_actor.movie_id
+	WHERE actor.id = $1 AND `+actingSQL+`
+	GROUP BY actor.id`, id)
+
+	var version int
+	actorInfo, err := scanActor(row, &version)
+	actorInfo.Version = version
+	if errors.Is(err, pgx.ErrNoRows) {
+		return actorInfo, ErrNotFound
+	}
+	if err != nil {
+		return actorInfo, fmt.Errorf("unable to query: %w", classify(err))
 	}
 
-	return moviesInfo, nil
+	return actorInfo, nil
 }
 
-func (pg *postgres) GetActors(ctx context.Context) ([]ActorInfo, error) {
+// scanMovie reads the columns every movie query starts with: the movie, its
+// release date precision, its cast as castSQL, its genres as genresSQL and its
+// crew as crewSQL. extra receives the columns that follow.
+func scanMovie(row pgx.Row, extra ...any) (MovieInfo, error) {
+	var movieInfo MovieInfo
+	var releaseDate *time.Time
+	var precision *int16
+
+	dest := append([]any{&movieInfo.ID, &movieInfo.Title, &movieInfo.Description,
+		&releaseDate, &precision, &movieInfo.Rating, &movieInfo.Actors, &movieInfo.Genres, &movieInfo.Crew}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return movieInfo, err
+	}
+
+	movieInfo.Release_date = dateFromDB(releaseDate, precision)
+
+	return movieInfo, nil
+}
+
+// scanActor is scanMovie for actors and their filmography.
+func scanActor(row pgx.Row, extra ...any) (ActorInfo, error) {
+	var actorInfo ActorInfo
+	var birthday *time.Time
+	var precision *int16
+
+	dest := append([]any{&actorInfo.ID, &actorInfo.Name, &actorInfo.Gender, &birthday, &precision, &actorInfo.Movies}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return actorInfo, err
+	}
+
+	actorInfo.Birthday = dateFromDB(birthday, precision)
+
+	return actorInfo, nil
+}
+
+func (pg *postgres) SearchMovies(ctx context.Context, search string, filter MovieFilter, sort []SortKey, page Page) (SearchPage, error) {
+	var searchPage SearchPage
+
+	if err := checkSort(sort, searchFields); err != nil {
+		return searchPage, err
+	}
+	if sort == nil {
+		sort = []SortKey{{Field: "relevance", Desc: true}}
+	}
+	if page.After != "" || page.Before != "" {
+		return searchPage, ErrInvalidCursor
+	}
 
-	query := `SELECT id, name, gender, birthday FROM actor`
+	title, description, name, term := foldSQL("movie.title"), foldSQL("movie.description"), foldSQL("actor.name"), foldSQL("$1")
+	document := fmt.Sprintf(`to_tsvector('simple', %s || ' ' || %s)`, title, description)
+	tsquery := fmt.Sprintf(`websearch_to_tsquery('simple', %s)`, term)
+	contains := likeContains(term)
+
+	// Every branch of match can use one of the indexes of 0002_search, so the
+	// movies are found without joining the whole catalogue to its cast.
+	match := fmt.Sprintf(`(%[1]s @@ %[2]s
+		OR %[3]s %% %[5]s
+		OR %[5]s <%% %[3]s
+		OR %[3]s LIKE %[6]s
+		OR movie.id IN (SELECT movie_actor.movie_id FROM movie_actor
+			JOIN person AS actor ON actor.id = movie_actor.actor_id
+			WHERE %[5]s <%% %[4]s OR %[4]s LIKE %[6]s))`, document, tsquery, title, name, term, contains)
+
+	filterConditions, args := filter.conditions([]any{search})
+	where := whereClause(append([]string{match}, filterConditions...))
+
+	err := pg.db.QueryRow(ctx, `SELECT count(*) FROM movie `+where, args...).Scan(&searchPage.Total)
+	if err != nil {
+		return searchPage, fmt.Errorf("unable to query: %w", classify(err))
+	}
 
-	rows, err := pg.db.Query(ctx, query)
+	// The credits and the score are aggregated for the matched movies only.
+	matches := fmt.Sprintf(`SELECT movie.id, movie.title, movie.description, movie.release_date, movie.release_date_precision, movie.rating,
+		%[6]s AS actors,
+		%[7]s AS genres,
+		%[8]s AS crew,
+		count(actor.id) AS actor_count,
+		greatest(
+			ts_rank(%[1]s, %[2]s),
+			similarity(%[5]s, %[3]s),
+			word_similarity(%[5]s, %[3]s),
+			COALESCE(max(word_similarity(%[5]s, %[4]s)), 0)
+		) AS score
+	FROM movie
+	LEFT JOIN movie_actor ON movie_actor.movie_id = movie.id
+	LEFT JOIN person AS actor ON actor.id = movie_actor.actor_id
+	%[9]s
+	GROUP BY movie.id`, document, tsquery, title, name, term, castSQL, genresSQL, crewSQL, where)
+
+	var limit any
+	if page.Limit > 0 {
+		limit = page.Limit
+	}
+	args = append(args, limit, page.Offset)
 
-	var actors []Actor
-	var actorsInfo []ActorInfo
+	query := fmt.Sprintf(`SELECT movie.id, movie.title, movie.description, movie.release_date, movie.release_date_precision,
+		movie.rating, movie.actors, movie.genres, movie.crew, movie.score
+	FROM (%s) AS movie
+	ORDER BY %s
+	LIMIT $%d OFFSET $%d`, matches, orderBy(sort, searchFields, "movie.id", false), len(args)-1, len(args))
 
+	rows, err := pg.db.Query(ctx, query, args...)
 	if err != nil {
-		return actorsInfo, fmt.Errorf("unable to query: %w", err)
+		return searchPage, fmt.Errorf("unable to query: %w", classify(err))
 	}
 	defer rows.Close()
 
-	actors, err = pgx.CollectRows(rows, pgx.RowToStructByName[Actor])
+	searchPage.Results, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (MovieSearchResult, error) {
+		var result MovieSearchResult
+		var err error
+
+		result.MovieInfo, err = scanMovie(row, &result.Score)
+		result.Highlights = highlightMovie(result.MovieInfo, search)
+
+		return result, err
+	})
 	if err != nil {
-		fmt.Printf("CollectRows error: %v", err)
-		return actorsInfo, err
+		return searchPage, fmt.Errorf("unable to query: %w", classify(err))
 	}
 
-	for _, v := range actors {
-		query = fmt.Sprintf(`SELECT movie.title from movie, movie_actor
-		WHERE movie_actor.actor_id = %d and movie.id = movie_actor.movie_id;`, v.ID)
+	return searchPage, nil
+}
 
-		rows, err := pg.db.Query(ctx, query)
+func (pg *postgres) CreateMovie(ctx context.Context, title string, description string, release_date Date, rating int, actors []Credit, genres []int) error {
+	actors, actorIDs, err := checkCredits(actors)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", classify(err))
+	}
+	genres = uniqueIDs(genres)
 
-		var movieTitles []MovieTitle
-		var actorInfo ActorInfo
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := checkActors(ctx, tx, actorIDs); err != nil {
+			return err
+		}
+		if err := checkGenres(ctx, tx, genres); err != nil {
+			return err
+		}
 
+		releaseDate, precision := release_date.dbArgs()
+
+		var id int
+		err := tx.QueryRow(ctx, `INSERT INTO movie (title, description, release_date, release_date_precision, rating)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`, title, description, releaseDate, precision, rating).Scan(&id)
 		if err != nil {
-			return actorsInfo, fmt.Errorf("unable to query: %w", err)
+			return fmt.Errorf("unable to insert row: %w", classify(err))
 		}
-		defer rows.Close()
 
-		movieTitles, err = pgx.CollectRows(rows, pgx.RowToStructByName[MovieTitle])
-		if err != nil {
-			fmt.Printf("CollectRows error: %v", err)
-			return actorsInfo, err
+		if err := linkActors(ctx, tx, id, actors); err != nil {
+			return err
 		}
+		return linkGenres(ctx, tx, id, genres)
+	})
+}
+
+// linkActors links the movie to the actors of credits, which must be unique,
+// and overwrites the parts of links that already exist.
+func linkActors(ctx context.Context, tx pgx.Tx, movieID int, credits []Credit) error {
+	args := pgx.NamedArgs{"movie_id": movieID}
+	actorIDs := make([]int, 0, len(credits))
+	characters := make([]string, 0, len(credits))
+	billings := make([]int, 0, len(credits))
+	roles := make([]string, 0, len(credits))
+	for _, c := range credits {
+		actorIDs = append(actorIDs, c.ActorID)
+		characters = append(characters, c.Character)
+		billings = append(billings, c.Billing)
+		roles = append(roles, string(c.Role))
+	}
+	args["actor_ids"], args["characters"], args["billings"], args["roles"] = actorIDs, characters, billings, roles
+
+	query := `INSERT INTO movie_actor (movie_id, actor_id, character_name, billing, role)
+	SELECT @movie_id::int, credit.actor_id, credit.character_name, credit.billing, credit.role
+	FROM unnest(@actor_ids::int[], @characters::text[], @billings::int[], @roles::text[])
+		AS credit (actor_id, character_name, billing, role)
+	ON CONFLICT (movie_id, actor_id) DO UPDATE
+	SET character_name = EXCLUDED.character_name, billing = EXCLUDED.billing, role = EXCLUDED.role`
+	_, err := tx.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", classify(err))
+	}
 
-		actorInfo.ID = v.ID
-		actorInfo.Name = v.Name
-		actorInfo.Gender = v.Gender
-		actorInfo.Birthday = v.Birthday
-		actorInfo.Movies = movieTitles
+	return nil
+}
 
-		actorsInfo = append(actorsInfo, actorInfo)
+func (pg *postgres) AddMovieActors(ctx context.Context, movieID int, version int, actors []Credit) error {
+	actors, actorIDs, err := checkCredits(actors)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", classify(err))
 	}
 
-	return actorsInfo, nil
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := checkVersion(ctx, tx, "movie", movieID, version); err != nil {
+			return err
+		}
+		if err := checkActors(ctx, tx, actorIDs); err != nil {
+			return err
+		}
+
+		if err := linkActors(ctx, tx, movieID, actors); err != nil {
+			return err
+		}
+		return bumpCast(ctx, tx, movieID)
+	})
 }
 
-func (pg *postgres) CreateMovie(ctx context.Context, title string, description string, release_date string, rating int, actors []int) error {
+func (pg *postgres) RemoveMovieActors(ctx context.Context, movieID int, version int, actors []int) error {
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := checkVersion(ctx, tx, "movie", movieID, version); err != nil {
+			return err
+		}
+		if err := bumpCast(ctx, tx, movieID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `DELETE FROM movie_actor WHERE movie_id = $1 AND actor_id = ANY($2)`, movieID, actors)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
 
-	// query := `INSERT INTO movie (title, description, release_date, rating)
-	// VALUES (@title, @description, @release_date, @rating)`
-	// args := pgx.NamedArgs{
-	// 	"title":        title,
-	// 	"description":  description,
-	// 	"release_date": release_date,
-	// 	"rating":       rating,
-	// }
-	// _, err := pg.db.Exec(ctx, query, args)
-	// if err != nil {
-	// 	return fmt.Errorf("unable to insert row: %w", err)
-	// }
+		return nil
+	})
+}
 
-	var id int
-	err := pg.db.QueryRow(context.Background(), `INSERT INTO movie (title, description, release_date, rating) 
-	VALUES ($1, $2, $3, $4) RETURNING id`, title, description, release_date, rating).Scan(&id)
+func (pg *postgres) ReplaceMovieActors(ctx context.Context, movieID int, version int, actors []Credit) error {
+	actors, actorIDs, err := checkCredits(actors)
 	if err != nil {
-		return fmt.Errorf("unable to insert row: %w", err)
+		return fmt.Errorf("unable to insert row: %w", classify(err))
 	}
 
-	for _, v := range actors {
-		query := `INSERT INTO movie_actor (movie_id, actor_id)
-		VALUES (@movie_id, @actor_id)`
-		args := pgx.NamedArgs{
-			"movie_id": id,
-			"actor_id": v,
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := checkVersion(ctx, tx, "movie", movieID, version); err != nil {
+			return err
+		}
+		if err := checkActors(ctx, tx, actorIDs); err != nil {
+			return err
 		}
-		_, err := pg.db.Exec(ctx, query, args)
+		if err := bumpCast(ctx, tx, movieID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `DELETE FROM movie_actor WHERE movie_id = $1 AND actor_id <> ALL($2)`, movieID, actorIDs)
 		if err != nil {
-			return fmt.Errorf("unable to insert row: %w", err)
+			return fmt.Errorf("unable to delete row: %w", classify(err))
 		}
+
+		if err := linkActors(ctx, tx, movieID, actors); err != nil {
+			return err
+		}
+		return bumpCast(ctx, tx, movieID)
+	})
+}
+
+// checkActors locks the given actors for the rest of tx, so they cannot be
+// deleted before the links to them are written, and reports the missing ones.
+func checkActors(ctx context.Context, tx pgx.Tx, actors []int) error {
+	if len(actors) == 0 {
+		return nil
 	}
 
-	return nil
+	rows, err := tx.Query(ctx, `SELECT id FROM person WHERE id = ANY($1) FOR SHARE`, actors)
+	if err != nil {
+		return fmt.Errorf("unable to query: %w", classify(err))
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	return missingActors(actors, found)
 }
 
-func (pg *postgres) CreateActor(ctx context.Context, name, gender, birthday string) error {
+func (pg *postgres) CreateActor(ctx context.Context, name, gender string, birthday Date) error {
+	return pg.CreatePerson(ctx, name, gender, birthday, DepartmentActing)
+}
+
+func (pg *postgres) CreatePerson(ctx context.Context, name, gender string, birthday Date, knownFor Department) error {
+	birthdayDate, precision := birthday.dbArgs()
 
-	query := `INSERT INTO actor (name, gender, birthday) 
-	VALUES (@name, @gender, @birthday)`
+	query := `INSERT INTO person (name, gender, birthday, birthday_precision, known_for) 
+	VALUES (@name, @gender, @birthday, @birthday_precision, @known_for)`
 	args := pgx.NamedArgs{
-		"name":     name,
-		"gender":   gender,
-		"birthday": birthday,
+		"name":               name,
+		"gender":             gender,
+		"birthday":           birthdayDate,
+		"birthday_precision": precision,
+		"known_for":          knownFor,
 	}
 	_, err := pg.db.Exec(ctx, query, args)
 	if err != nil {
-		return fmt.Errorf("unable to insert row: %w", err)
+		return fmt.Errorf("unable to insert row: %w", classify(err))
+	}
+
+	return nil
+}
+
+// DeleteMovie deletes the movie with its links. A version other than 0 must
+// be the current one; a movie that does not exist is already deleted.
+func (pg *postgres) DeleteMovie(ctx context.Context, id int, version int) error {
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		err := checkVersion(ctx, tx, "movie", id, version)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := bumpCredited(ctx, tx, id); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM movie_actor WHERE movie_id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM movie_genre WHERE movie_id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM movie_crew WHERE movie_id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM movie WHERE id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		return nil
+	})
+}
+
+func (pg *postgres) DeleteActor(ctx context.Context, id int, version int) error {
+	return pg.DeletePerson(ctx, id, version)
+}
+
+// DeletePerson deletes the person with all their cast and crew credits. The
+// version is checked like in DeleteMovie.
+func (pg *postgres) DeletePerson(ctx context.Context, id int, version int) error {
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		err := checkVersion(ctx, tx, "person", id, version)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := bumpFilmography(ctx, tx, id); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM movie_actor WHERE actor_id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM movie_crew WHERE person_id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM person WHERE id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		return nil
+	})
+}
+
+// UpdateMovie is PatchMovie for the fields that are not empty or 0.
+func (pg *postgres) UpdateMovie(ctx context.Context, id int, version int, title string, description string, release_date Date, rating int) error {
+	patch, ok := moviePatch(title, description, release_date, rating)
+	if !ok {
+		return ErrNoChanges
+	}
+	return pg.PatchMovie(ctx, id, version, patch)
+}
+
+func (pg *postgres) UpdateActor(ctx context.Context, id int, version int, name string, gender string, birthday Date) error {
+	return pg.UpdatePerson(ctx, id, version, name, gender, birthday, "")
+}
+
+// UpdatePerson is PatchPerson for the fields that are not empty.
+func (pg *postgres) UpdatePerson(ctx context.Context, id int, version int, name, gender string, birthday Date, knownFor Department) error {
+	patch, ok := personPatch(name, gender, birthday, knownFor)
+	if !ok {
+		return ErrNoChanges
+	}
+	return pg.PatchPerson(ctx, id, version, patch)
+}
+
+// PatchMovie changes the fields of the movie that the patch sets. A version
+// other than 0 must be the current one. It returns ErrNotFound when there is
+// no such movie.
+func (pg *postgres) PatchMovie(ctx context.Context, id int, version int, patch MoviePatch) error {
+
+	var updateData []string
+	args := pgx.NamedArgs{"id": id}
+
+	if patch.Title.Set {
+		updateData = append(updateData, `title = @title`)
+		args["title"] = patch.Title.Value
+	}
+	if patch.Description.Set {
+		updateData = append(updateData, `description = @description`)
+		args["description"] = patch.Description.Value
+	}
+	if patch.Release_date.Set {
+		updateData = append(updateData, `release_date = @release_date, release_date_precision = @release_date_precision`)
+		args["release_date"], args["release_date_precision"] = patch.Release_date.Value.dbArgs()
+	}
+	if patch.Rating.Set {
+		updateData = append(updateData, `rating = @rating`)
+		args["rating"] = patch.Rating.Value
+	}
+
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := checkVersion(ctx, tx, "movie", id, version); err != nil {
+			return err
+		}
+		if len(updateData) == 0 {
+			return nil
+		}
+		if err := updateRow(ctx, tx, "movie", updateData, args); err != nil {
+			return err
+		}
+		return bumpCredited(ctx, tx, id)
+	})
+}
+
+// PatchPerson changes the fields of the person that the patch sets, like
+// PatchMovie.
+func (pg *postgres) PatchPerson(ctx context.Context, id int, version int, patch PersonPatch) error {
+
+	var updateData []string
+	args := pgx.NamedArgs{"id": id}
+
+	if patch.Name.Set {
+		updateData = append(updateData, `name = @name`)
+		args["name"] = patch.Name.Value
+	}
+	if patch.Gender.Set {
+		updateData = append(updateData, `gender = @gender`)
+		args["gender"] = patch.Gender.Value
+	}
+	if patch.Birthday.Set {
+		updateData = append(updateData, `birthday = @birthday, birthday_precision = @birthday_precision`)
+		args["birthday"], args["birthday_precision"] = patch.Birthday.Value.dbArgs()
+	}
+	if patch.KnownFor.Set {
+		updateData = append(updateData, `known_for = @known_for`)
+		args["known_for"] = patch.KnownFor.Value
+	}
+
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := checkVersion(ctx, tx, "person", id, version); err != nil {
+			return err
+		}
+		if len(updateData) == 0 {
+			return nil
+		}
+		if err := updateRow(ctx, tx, "person", updateData, args); err != nil {
+			return err
+		}
+		return bumpFilmography(ctx, tx, id)
+	})
+}
+
+// updateRow sets the columns of updateData in the row of the table with the
+// id of args and raises its version.
+func updateRow(ctx context.Context, tx pgx.Tx, table string, updateData []string, args pgx.NamedArgs) error {
+	query := fmt.Sprintf(`UPDATE %s SET %s, version = version + 1 WHERE id = @id`, table, strings.Join(updateData, ", "))
+
+	_, err := tx.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", classify(err))
+	}
+
+	return nil
+}
+
+// checkVersion locks the row of the table for the rest of tx and reports a
+// missing row, or one whose version is not version. Version 0 matches any.
+func checkVersion(ctx context.Context, tx pgx.Tx, table string, id int, version int) error {
+	var current int
+	query := fmt.Sprintf(`SELECT version FROM %s WHERE id = $1 FOR UPDATE`, table)
+	err := tx.QueryRow(ctx, query, id).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("unable to query: %w", classify(err))
+	}
+	if version != 0 && version != current {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// bumpMovie raises the version of the movie after a change to its links.
+func bumpMovie(ctx context.Context, tx pgx.Tx, id int) error {
+	_, err := tx.Exec(ctx, `UPDATE movie SET version = version + 1 WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", classify(err))
+	}
+	return nil
+}
+
+// bumpCast raises the versions of the movie and of the people credited in
+// it. Changes to the credits call it before and after, so that the people
+// who lose and gain a credit are both bumped.
+func bumpCast(ctx context.Context, tx pgx.Tx, movieID int) error {
+	if err := bumpMovie(ctx, tx, movieID); err != nil {
+		return err
+	}
+	return bumpCredited(ctx, tx, movieID)
+}
+
+// bumpGenre raises the versions of the movies of the genre, which show its
+// name.
+func bumpGenre(ctx context.Context, tx pgx.Tx, genreID int) error {
+	_, err := tx.Exec(ctx, `UPDATE movie SET version = version + 1
+	WHERE id IN (SELECT movie_id FROM movie_genre WHERE genre_id = $1)`, genreID)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", classify(err))
 	}
+	return nil
+}
 
+// bumpCredited raises the versions of the people credited in the movie,
+// whose filmographies show it.
+func bumpCredited(ctx context.Context, tx pgx.Tx, movieID int) error {
+	_, err := tx.Exec(ctx, `UPDATE person SET version = version + 1
+	WHERE id IN (SELECT actor_id FROM movie_actor WHERE movie_id = $1
+		UNION SELECT person_id FROM movie_crew WHERE movie_id = $1)`, movieID)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", classify(err))
+	}
 	return nil
 }
 
-func (pg *postgres) DeleteMovie(ctx context.Context, id int) error {
+// bumpFilmography raises the versions of the movies the person is credited
+// in, whose casts and crews show them.
+func bumpFilmography(ctx context.Context, tx pgx.Tx, personID int) error {
+	_, err := tx.Exec(ctx, `UPDATE movie SET version = version + 1
+	WHERE id IN (SELECT movie_id FROM movie_actor WHERE actor_id = $1
+		UNION SELECT movie_id FROM movie_crew WHERE person_id = $1)`, personID)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", classify(err))
+	}
+	return nil
+}
+
+func (pg *postgres) GetGenres(ctx context.Context) ([]GenreCount, error) {
+	rows, err := pg.db.Query(ctx, `SELECT genre.id, genre.name, count(movie_genre.movie_id)
+	FROM genre
+	LEFT JOIN movie_genre ON movie_genre.genre_id = genre.id
+	GROUP BY genre.id
+	ORDER BY genre.name`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	genres, err := pgx.CollectRows(rows, scanGenreCount)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	return genres, nil
+}
+
+func scanGenreCount(row pgx.CollectableRow) (GenreCount, error) {
+	var genre GenreCount
+	err := row.Scan(&genre.ID, &genre.Name, &genre.Count)
+	return genre, err
+}
+
+func (pg *postgres) GetGenre(ctx context.Context, id int) (Genre, error) {
+	var genre Genre
 
-	query := fmt.Sprintf(`DELETE FROM movie WHERE id = %d`, id)
-	_, err := pg.db.Exec(ctx, query)
+	err := pg.db.QueryRow(ctx, `SELECT id, name FROM genre WHERE id = $1`, id).Scan(&genre.ID, &genre.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return genre, ErrNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("unable to delete row: %w", err)
+		return genre, fmt.Errorf("unable to query: %w", classify(err))
 	}
 
-	query = fmt.Sprintf(`DELETE FROM movie_actor WHERE movie_id = %d`, id)
-	_, err = pg.db.Exec(ctx, query)
+	return genre, nil
+}
+
+func (pg *postgres) CreateGenre(ctx context.Context, name string) error {
+	_, err := pg.db.Exec(ctx, `INSERT INTO genre (name) VALUES ($1)`, name)
+	if isUniqueViolation(err) {
+		return ErrGenreExists
+	}
 	if err != nil {
-		return fmt.Errorf("unable to delete row: %w", err)
+		return fmt.Errorf("unable to insert row: %w", classify(err))
 	}
 
 	return nil
 }
 
-func (pg *postgres) DeleteActor(ctx context.Context, id int) error {
+func (pg *postgres) UpdateGenre(ctx context.Context, id int, name string) error {
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE genre SET name = $2 WHERE id = $1`, id, name)
+		if isUniqueViolation(err) {
+			return ErrGenreExists
+		}
+		if err != nil {
+			return fmt.Errorf("unable to update row: %w", classify(err))
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		return bumpGenre(ctx, tx, id)
+	})
+}
+
+func (pg *postgres) DeleteGenre(ctx context.Context, id int) error {
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := bumpGenre(ctx, tx, id); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `DELETE FROM movie_genre WHERE genre_id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM genre WHERE id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		return nil
+	})
+}
+
+func (pg *postgres) SetMovieGenres(ctx context.Context, movieID int, version int, genres []int) error {
+	genres = uniqueIDs(genres)
+
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := checkVersion(ctx, tx, "movie", movieID, version); err != nil {
+			return err
+		}
+		if err := checkGenres(ctx, tx, genres); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `DELETE FROM movie_genre WHERE movie_id = $1 AND genre_id <> ALL($2)`, movieID, genres)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		if err := linkGenres(ctx, tx, movieID, genres); err != nil {
+			return err
+		}
+		return bumpMovie(ctx, tx, movieID)
+	})
+}
+
+// checkGenres is checkActors for genres.
+func checkGenres(ctx context.Context, tx pgx.Tx, genres []int) error {
+	if len(genres) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id FROM genre WHERE id = ANY($1) FOR SHARE`, genres)
+	if err != nil {
+		return fmt.Errorf("unable to query: %w", classify(err))
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	return missingGenres(genres, found)
+}
+
+// linkGenres tags the movie with genres, skipping tags that already exist.
+func linkGenres(ctx context.Context, tx pgx.Tx, movieID int, genres []int) error {
+	_, err := tx.Exec(ctx, `INSERT INTO movie_genre (movie_id, genre_id)
+	SELECT $1::int, unnest($2::int[])
+	ON CONFLICT DO NOTHING`, movieID, genres)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", classify(err))
+	}
+
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (pg *postgres) GetPerson(ctx context.Context, id int) (PersonInfo, error) {
+	var personInfo PersonInfo
+	var birthday *time.Time
+	var precision *int16
+
+	err := pg.db.QueryRow(ctx, `SELECT id, name, gender, birthday, birthday_precision, known_for, version
+	FROM person WHERE id = $1`, id).Scan(&personInfo.ID, &personInfo.Name, &personInfo.Gender, &birthday, &precision, &personInfo.KnownFor, &personInfo.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return personInfo, ErrNotFound
+	}
+	if err != nil {
+		return personInfo, fmt.Errorf("unable to query: %w", classify(err))
+	}
+	personInfo.Birthday = dateFromDB(birthday, precision)
+
+	rows, err := pg.db.Query(ctx, `SELECT 'acting', movie.id, movie.title, movie.release_date, movie.release_date_precision,
+		'', movie_actor.character_name, movie_actor.billing, movie_actor.role
+	FROM movie_actor
+	JOIN movie ON movie.id = movie_actor.movie_id
+	WHERE movie_actor.actor_id = $1
+	UNION ALL
+	SELECT movie_crew.department, movie.id, movie.title, movie.release_date, movie.release_date_precision,
+		movie_crew.job, '', 0, ''
+	FROM movie_crew
+	JOIN movie ON movie.id = movie_crew.movie_id
+	WHERE movie_crew.person_id = $1`, id)
+	if err != nil {
+		return personInfo, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	credits, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (departmentCredit, error) {
+		var c departmentCredit
+		var releaseDate *time.Time
+		var precision *int16
+
+		err := row.Scan(&c.Department, &c.ID, &c.Title, &releaseDate, &precision,
+			&c.Job, &c.Character, &c.Billing, &c.Role)
+		c.Release_date = dateFromDB(releaseDate, precision)
+		return c, err
+	})
+	if err != nil {
+		return personInfo, fmt.Errorf("unable to query: %w", classify(err))
+	}
+	personInfo.Filmography = groupFilmography(credits)
+
+	return personInfo, nil
+}
+
+func (pg *postgres) ReplaceMovieCrew(ctx context.Context, movieID int, version int, crew []CrewCredit) error {
+	crew, personIDs, err := checkCrew(crew)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", classify(err))
+	}
+
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		if err := checkVersion(ctx, tx, "movie", movieID, version); err != nil {
+			return err
+		}
+		if err := checkPeople(ctx, tx, personIDs); err != nil {
+			return err
+		}
+		if err := bumpCast(ctx, tx, movieID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `DELETE FROM movie_crew WHERE movie_id = $1`, movieID)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		args := pgx.NamedArgs{"movie_id": movieID}
+		ids := make([]int, 0, len(crew))
+		departments := make([]string, 0, len(crew))
+		jobs := make([]string, 0, len(crew))
+		for _, c := range crew {
+			ids = append(ids, c.PersonID)
+			departments = append(departments, string(c.Department))
+			jobs = append(jobs, c.Job)
+		}
+		args["person_ids"], args["departments"], args["jobs"] = ids, departments, jobs
+
+		_, err = tx.Exec(ctx, `INSERT INTO movie_crew (movie_id, person_id, department, job)
+		SELECT @movie_id::int, credit.person_id, credit.department, credit.job
+		FROM unnest(@person_ids::int[], @departments::text[], @jobs::text[])
+			AS credit (person_id, department, job)`, args)
+		if err != nil {
+			return fmt.Errorf("unable to insert row: %w", classify(err))
+		}
+
+		return bumpCast(ctx, tx, movieID)
+	})
+}
+
+// checkPeople is checkActors for crews.
+func checkPeople(ctx context.Context, tx pgx.Tx, people []int) error {
+	if len(people) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id FROM person WHERE id = ANY($1) FOR SHARE`, people)
+	if err != nil {
+		return fmt.Errorf("unable to query: %w", classify(err))
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	return missingPeople(people, found)
+}
+
+func (pg *postgres) GetUsers(ctx context.Context) ([]User, error) {
+	rows, err := pg.db.Query(ctx, `SELECT id, username, role, disabled, created_at, password_hash FROM users ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	users, err := pgx.CollectRows(rows, scanUser)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	return users, nil
+}
+
+func (pg *postgres) GetUser(ctx context.Context, id int) (User, error) {
+	var user User
 
-	query := fmt.Sprintf(`DELETE FROM actor WHERE id = %d`, id)
-	_, err := pg.db.Exec(ctx, query)
+	err := pg.db.QueryRow(ctx, `SELECT id, username, role, disabled, created_at, password_hash
+	FROM users WHERE id = $1`, id).Scan(&user.ID, &user.Username, &user.Role, &user.Disabled, &user.CreatedAt, &user.PasswordHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return user, ErrNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("unable to delete row: %w", err)
+		return user, fmt.Errorf("unable to query: %w", classify(err))
 	}
 
-	query = fmt.Sprintf(`DELETE FROM movie_actor WHERE actor_id = %d`, id)
-	_, err = pg.db.Exec(ctx, query)
+	return user, nil
+}
+
+func (pg *postgres) GetUserByName(ctx context.Context, username string) (User, error) {
+	var user User
+
+	err := pg.db.QueryRow(ctx, `SELECT id, username, role, disabled, created_at, password_hash
+	FROM users WHERE lower(username) = lower($1)`, username).Scan(&user.ID, &user.Username, &user.Role, &user.Disabled, &user.CreatedAt, &user.PasswordHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	if err != nil {
+		return user, fmt.Errorf("unable to query: %w", classify(err))
+	}
+
+	return user, nil
+}
+
+func scanUser(row pgx.CollectableRow) (User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Username, &user.Role, &user.Disabled, &user.CreatedAt, &user.PasswordHash)
+	return user, err
+}
+
+func (pg *postgres) CreateUser(ctx context.Context, username string, passwordHash []byte, role UserRole) error {
+	_, err := pg.db.Exec(ctx, `INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3)`, username, passwordHash, role)
+	if isUniqueViolation(err) {
+		return ErrUserExists
+	}
 	if err != nil {
-		return fmt.Errorf("unable to delete row: %w", err)
+		return fmt.Errorf("unable to insert row: %w", classify(err))
 	}
 
 	return nil
 }
 
-func (pg *postgres) UpdateMovie(ctx context.Context, id int, title string, description string, release_date string, rating int) error {
+func (pg *postgres) SetUserPassword(ctx context.Context, id int, passwordHash []byte) error {
+	tag, err := pg.db.Exec(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, id, passwordHash)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", classify(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
 
-	updateData := ""
+	return nil
+}
 
-	if title != "" {
-		updateData += fmt.Sprintf(`title = '%s', `, title)
+func (pg *postgres) SetUserDisabled(ctx context.Context, id int, disabled bool) error {
+	tag, err := pg.db.Exec(ctx, `UPDATE users SET disabled = $2 WHERE id = $1`, id, disabled)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", classify(err))
 	}
-	if description != "" {
-		updateData += fmt.Sprintf(`description = '%s', `, description)
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
 	}
-	if release_date != "" {
-		updateData += fmt.Sprintf(`release_date = '%s', `, release_date)
+
+	return nil
+}
+
+func (pg *postgres) SetUserRole(ctx context.Context, id int, role UserRole) error {
+	tag, err := pg.db.Exec(ctx, `UPDATE users SET role = $2 WHERE id = $1`, id, role)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", classify(err))
 	}
-	if rating != 0 {
-		updateData += fmt.Sprintf(`rating = %d, `, rating)
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
 	}
-	if len(updateData) < 2 {
-		return fmt.Errorf("fields to change must be specified")
+
+	return nil
+}
+
+func (pg *postgres) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	_, err := pg.db.Exec(ctx, `INSERT INTO refresh_token (token_hash, user_id, family, expires_at)
+	VALUES ($1, $2, $3, $4)`, token.Hash, token.UserID, token.Family, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", classify(err))
+	}
+
+	return nil
+}
+
+// RotateRefreshToken revokes the token and stores next in its place, for the
+// same user and family. A revoked token revokes its whole family instead.
+func (pg *postgres) RotateRefreshToken(ctx context.Context, hash string, next RefreshToken) (RefreshToken, error) {
+	valid := false
+	err := pg.inTx(ctx, func(tx pgx.Tx) error {
+		var expiresAt time.Time
+		var revoked bool
+
+		err := tx.QueryRow(ctx, `SELECT user_id, family, expires_at, revoked_at IS NOT NULL
+		FROM refresh_token WHERE token_hash = $1 FOR UPDATE`, hash).Scan(&next.UserID, &next.Family, &expiresAt, &revoked)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to query: %w", classify(err))
+		}
+
+		// The revocation of a reused family has to be committed, so invalid
+		// tokens are reported after the transaction.
+		if revoked {
+			_, err = tx.Exec(ctx, `UPDATE refresh_token SET revoked_at = now()
+			WHERE family = $1 AND revoked_at IS NULL`, next.Family)
+			if err != nil {
+				return fmt.Errorf("unable to update row: %w", classify(err))
+			}
+			return nil
+		}
+		if !expiresAt.After(time.Now()) {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE refresh_token SET revoked_at = now() WHERE token_hash = $1`, hash)
+		if err != nil {
+			return fmt.Errorf("unable to update row: %w", classify(err))
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO refresh_token (token_hash, user_id, family, expires_at)
+		VALUES ($1, $2, $3, $4)`, next.Hash, next.UserID, next.Family, next.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("unable to insert row: %w", classify(err))
+		}
+
+		valid = true
+		return nil
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if !valid {
+		return RefreshToken{}, ErrInvalidToken
 	}
-	updateData = updateData[:len(updateData)-2]
 
-	query := fmt.Sprintf(`UPDATE movie SET %s WHERE id = %d`, updateData, id)
+	return next, nil
+}
 
-	_, err := pg.db.Exec(ctx, query)
+// RevokeRefreshTokens revokes the family of the token. Unknown tokens are
+// ignored.
+func (pg *postgres) RevokeRefreshTokens(ctx context.Context, hash string) error {
+	_, err := pg.db.Exec(ctx, `UPDATE refresh_token SET revoked_at = now()
+	WHERE revoked_at IS NULL AND family = (SELECT family FROM refresh_token WHERE token_hash = $1)`, hash)
 	if err != nil {
-		return fmt.Errorf("unable to update row: %w", err)
+		return fmt.Errorf("unable to update row: %w", classify(err))
 	}
 
 	return nil
 }
 
-func (pg *postgres) UpdateActor(ctx context.Context, id int, name string, gender string, birthday string) error {
+// RevokeAccessToken stores the ID of the access token until it expires.
+// Expired revocations are dropped on the way.
+func (pg *postgres) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return pg.inTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO revoked_token (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, jti, expiresAt)
+		if err != nil {
+			return fmt.Errorf("unable to insert row: %w", classify(err))
+		}
 
-	updateData := ""
+		_, err = tx.Exec(ctx, `DELETE FROM revoked_token WHERE expires_at < now()`)
+		if err != nil {
+			return fmt.Errorf("unable to delete row: %w", classify(err))
+		}
+
+		return nil
+	})
+}
 
-	if name != "" {
-		updateData += fmt.Sprintf(`name = '%s', `, name)
+func (pg *postgres) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+
+	err := pg.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_token WHERE jti = $1)`, jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("unable to query: %w", classify(err))
 	}
-	if gender != "" {
-		updateData += fmt.Sprintf(`gender = '%s', `, gender)
+
+	return revoked, nil
+}
+
+func (pg *postgres) GetAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := pg.db.Query(ctx, `SELECT id, name, prefix, scopes, created_at, last_used_at, key_hash
+	FROM api_key ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", classify(err))
 	}
-	if birthday != "" {
-		updateData += fmt.Sprintf(`birthday = '%s', `, birthday)
+
+	keys, err := pgx.CollectRows(rows, scanAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", classify(err))
 	}
-	if len(updateData) < 2 {
-		return fmt.Errorf("fields to change must be specified")
+
+	return keys, nil
+}
+
+func (pg *postgres) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	var key APIKey
+
+	err := pg.db.QueryRow(ctx, `SELECT id, name, prefix, scopes, created_at, last_used_at, key_hash
+	FROM api_key WHERE key_hash = $1`, hash).Scan(&key.ID, &key.Name, &key.Prefix, &key.Scopes, &key.CreatedAt, &key.LastUsedAt, &key.Hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return key, ErrNotFound
+	}
+	if err != nil {
+		return key, fmt.Errorf("unable to query: %w", classify(err))
 	}
-	updateData = updateData[:len(updateData)-2]
 
-	query := fmt.Sprintf(`UPDATE actor SET %s WHERE id = %d`, updateData, id)
+	return key, nil
+}
+
+func scanAPIKey(row pgx.CollectableRow) (APIKey, error) {
+	var key APIKey
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Scopes, &key.CreatedAt, &key.LastUsedAt, &key.Hash)
+	return key, err
+}
+
+// CreateAPIKey stores the key and returns it with its ID and creation time.
+func (pg *postgres) CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error) {
+	err := pg.db.QueryRow(ctx, `INSERT INTO api_key (name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`, key.Name, key.Prefix, key.Hash, key.Scopes).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return key, fmt.Errorf("unable to insert row: %w", classify(err))
+	}
+
+	return key, nil
+}
+
+func (pg *postgres) DeleteAPIKey(ctx context.Context, id int) error {
+	tag, err := pg.db.Exec(ctx, `DELETE FROM api_key WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("unable to delete row: %w", classify(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
 
-	_, err := pg.db.Exec(ctx, query)
+// TouchAPIKey records that the key has just been used.
+func (pg *postgres) TouchAPIKey(ctx context.Context, id int) error {
+	_, err := pg.db.Exec(ctx, `UPDATE api_key SET last_used_at = now() WHERE id = $1`, id)
 	if err != nil {
-		return fmt.Errorf("unable to update row: %w", err)
+		return fmt.Errorf("unable to update row: %w", classify(err))
 	}
 
 	return nil
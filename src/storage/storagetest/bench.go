@@ -0,0 +1,68 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"vktest/src/storage"
+)
+
+// Seed fills s with the given number of movies and actors. Every movie is
+// linked to actorsPerMovie actors, picked round-robin.
+func Seed(tb testing.TB, s storage.Storage, movies, actors, actorsPerMovie int) {
+	tb.Helper()
+	ctx := context.Background()
+
+	for i := 0; i < actors; i++ {
+		if err := s.CreateActor(ctx, fmt.Sprintf("Actor %d", i), "", date("1970-01-01")); err != nil {
+			tb.Fatalf("CreateActor: %v", err)
+		}
+	}
+
+	actorsPage, err := s.GetActors(ctx, storage.ActorFilter{}, nil, storage.Page{})
+	if err != nil {
+		tb.Fatalf("GetActors: %v", err)
+	}
+	actorsInfo := actorsPage.Actors
+	if len(actorsInfo) == 0 && actorsPerMovie > 0 {
+		tb.Fatal("Seed: actorsPerMovie needs at least one actor")
+	}
+
+	for i := 0; i < movies; i++ {
+		cast := make([]storage.Credit, 0, actorsPerMovie)
+		for j := 0; j < actorsPerMovie; j++ {
+			cast = append(cast, storage.Credit{
+				ActorID: actorsInfo[(i+j)%len(actorsInfo)].ID,
+				Part:    storage.Part{Billing: j + 1},
+			})
+		}
+		err := s.CreateMovie(ctx, fmt.Sprintf("Movie %d", i), "seeded", date("2000-01-01"), i%11, cast, nil)
+		if err != nil {
+			tb.Fatalf("CreateMovie: %v", err)
+		}
+	}
+}
+
+// BenchmarkGetMovies measures listing a store that was seeded beforehand,
+// e.g. with Seed(b, s, 10000, 2000, 5).
+func BenchmarkGetMovies(b *testing.B, s storage.Storage) {
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetMovies(ctx, storage.MovieFilter{}, storage.ParseSort("-rating"), storage.Page{}); err != nil {
+			b.Fatalf("GetMovies: %v", err)
+		}
+	}
+}
+
+// BenchmarkGetActors measures listing a store that was seeded beforehand.
+func BenchmarkGetActors(b *testing.B, s storage.Storage) {
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetActors(ctx, storage.ActorFilter{}, nil, storage.Page{}); err != nil {
+			b.Fatalf("GetActors: %v", err)
+		}
+	}
+}
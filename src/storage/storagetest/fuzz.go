@@ -0,0 +1,110 @@
+package storagetest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"vktest/src/storage"
+)
+
+// FuzzMutations pushes arbitrary strings through every mutating Storage
+// method, as text and, where they parse, as dates. Inputs a backend rejects
+// may fail, but whatever is accepted has to be stored verbatim, and no input
+// may break later queries.
+func FuzzMutations(f *testing.F, s storage.Storage) {
+	for _, seed := range []string{
+		"Ocean's Eleven",
+		"'; DROP TABLE movie; --",
+		`\'); DELETE FROM actor; --`,
+		"$1 @id %s %d",
+		"Бойцовский клуб",
+		"1999-09",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		ctx := context.Background()
+		// Postgres rejects invalid UTF-8, NUL bytes and values longer than
+		// the shortest column, VARCHAR(30).
+		storable := utf8.ValidString(value) && !strings.ContainsRune(value, 0) &&
+			utf8.RuneCountInString(value) <= 30
+		d, _ := storage.ParseDate(value)
+
+		if err := s.CreateActor(ctx, value, value, d); err == nil {
+			actor := latestActor(t, s)
+			if actor.Name != value || actor.Gender != value || actor.Birthday != d {
+				t.Errorf("CreateActor(%q) stored %+v", value, actor)
+			}
+		} else if storable {
+			t.Errorf("CreateActor(%q): %v", value, err)
+		}
+		actorID := latestActor(t, s).ID
+
+		if err := s.CreateMovie(ctx, value, value, d, 5, storage.Credits(actorID), nil); err == nil {
+			movie := latestMovie(t, s)
+			if movie.Title != value || movie.Description != value || movie.Release_date != d {
+				t.Errorf("CreateMovie(%q) stored %+v", value, movie)
+			}
+		} else if storable {
+			t.Errorf("CreateMovie(%q): %v", value, err)
+		}
+		movieID := latestMovie(t, s).ID
+
+		if err := s.UpdateMovie(ctx, movieID, 0, value, value, d, 7); err == nil && value != "" {
+			movie := latestMovie(t, s)
+			if movie.Title != value || movie.Description != value || movie.Release_date != d || movie.Rating != 7 {
+				t.Errorf("UpdateMovie(%q) stored %+v", value, movie)
+			}
+		} else if err != nil && storable {
+			t.Errorf("UpdateMovie(%q): %v", value, err)
+		}
+
+		if err := s.UpdateActor(ctx, actorID, 0, value, value, d); err == nil && value != "" {
+			actor := latestActor(t, s)
+			if actor.Name != value || actor.Gender != value || actor.Birthday != d {
+				t.Errorf("UpdateActor(%q) stored %+v", value, actor)
+			}
+		} else if err != nil && storable && value != "" {
+			t.Errorf("UpdateActor(%q): %v", value, err)
+		}
+
+		if _, err := s.SearchMovies(ctx, value, storage.MovieFilter{}, nil, storage.Page{Limit: 1}); err != nil && storable {
+			t.Errorf("SearchMovies(%q): %v", value, err)
+		}
+
+		if err := s.DeleteMovie(ctx, movieID, 0); err != nil {
+			t.Errorf("DeleteMovie: %v", err)
+		}
+		if err := s.DeleteActor(ctx, actorID, 0); err != nil {
+			t.Errorf("DeleteActor: %v", err)
+		}
+	})
+}
+
+func latestMovie(t *testing.T, s storage.Storage) storage.MovieInfo {
+	t.Helper()
+	page, err := s.GetMovies(context.Background(), storage.MovieFilter{}, storage.ParseSort("-id"), storage.Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetMovies: %v", err)
+	}
+	if len(page.Movies) == 0 {
+		return storage.MovieInfo{}
+	}
+	return page.Movies[0]
+}
+
+func latestActor(t *testing.T, s storage.Storage) storage.ActorInfo {
+	t.Helper()
+	page, err := s.GetActors(context.Background(), storage.ActorFilter{}, storage.ParseSort("-id"), storage.Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	if len(page.Actors) == 0 {
+		return storage.ActorInfo{}
+	}
+	return page.Actors[0]
+}
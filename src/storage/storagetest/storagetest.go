@@ -0,0 +1,1658 @@
+// Package storagetest holds the conformance suite that every storage.Storage
+// implementation must pass. Backends call Run from their own tests with a
+// factory that hands out an empty store for each subtest.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"vktest/src/storage"
+)
+
+// Factory returns a fresh, empty storage. For postgres this means truncated
+// movie, person and link tables.
+type Factory func(t *testing.T) storage.Storage
+
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"Empty", testEmpty},
+		{"CreateAndList", testCreateAndList},
+		{"Sorting", testSorting},
+		{"Links", testLinks},
+		{"GetByID", testGetByID},
+		{"ManageCast", testManageCast},
+		{"Credits", testCredits},
+		{"UnknownActor", testUnknownActor},
+		{"DeleteMovieCascades", testDeleteMovieCascades},
+		{"DeleteActorCascades", testDeleteActorCascades},
+		{"UpdateMovie", testUpdateMovie},
+		{"UpdateActor", testUpdateActor},
+		{"UpdateWithoutFields", testUpdateWithoutFields},
+		{"PatchMovie", testPatchMovie},
+		{"PatchPerson", testPatchPerson},
+		{"Versions", testVersions},
+		{"PartialDates", testPartialDates},
+		{"DateFilters", testDateFilters},
+		{"Genres", testGenres},
+		{"GenreFilters", testGenreFilters},
+		{"People", testPeople},
+		{"Crew", testCrew},
+		{"Users", testUsers},
+		{"Tokens", testTokens},
+		{"APIKeys", testAPIKeys},
+		{"UnknownSortField", testUnknownSortField},
+		{"ActorSorting", testActorSorting},
+		{"OffsetPagination", testOffsetPagination},
+		{"CursorPagination", testCursorPagination},
+		{"ActorPagination", testActorPagination},
+		{"InvalidCursor", testInvalidCursor},
+		{"Search", testSearch},
+		{"SearchRanking", testSearchRanking},
+		{"SearchPaging", testSearchPaging},
+		{"SearchHighlightEscaping", testSearchHighlightEscaping},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+func testEmpty(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	movies, err := s.GetMovies(ctx, storage.MovieFilter{}, storage.ParseSort("-rating"), storage.Page{})
+	if err != nil {
+		t.Fatalf("GetMovies: %v", err)
+	}
+	if len(movies.Movies) != 0 || movies.Total != 0 {
+		t.Fatalf("GetMovies: got %d movies of %d, want 0", len(movies.Movies), movies.Total)
+	}
+
+	actors, err := s.GetActors(ctx, storage.ActorFilter{}, nil, storage.Page{})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	if len(actors.Actors) != 0 || actors.Total != 0 {
+		t.Fatalf("GetActors: got %d actors of %d, want 0", len(actors.Actors), actors.Total)
+	}
+}
+
+func testCreateAndList(t *testing.T, s storage.Storage) {
+	mustCreateActor(t, s, "Brad Pitt", "male", "1963-12-18")
+	mustCreateMovie(t, s, "Fight Club", "Insomniac meets soap maker", "1999-09-10", 10)
+
+	movies := mustGetMovies(t, s, "-rating")
+	if len(movies) != 1 {
+		t.Fatalf("got %d movies, want 1", len(movies))
+	}
+	m := movies[0]
+	if m.ID == 0 || m.Title != "Fight Club" || m.Description != "Insomniac meets soap maker" ||
+		m.Release_date.String() != "1999-09-10" || m.Rating != 10 {
+		t.Errorf("unexpected movie %+v", m)
+	}
+	if len(m.Actors) != 0 {
+		t.Errorf("got actors %v, want none", m.Actors)
+	}
+
+	actors := mustGetActors(t, s)
+	if len(actors) != 1 {
+		t.Fatalf("got %d actors, want 1", len(actors))
+	}
+	a := actors[0]
+	if a.ID == 0 || a.Name != "Brad Pitt" || a.Gender != "male" || a.Birthday.String() != "1963-12-18" {
+		t.Errorf("unexpected actor %+v", a)
+	}
+}
+
+func testSorting(t *testing.T, s storage.Storage) {
+	mustCreateMovie(t, s, "Troy", "", "2004-05-14", 7)
+	mustCreateMovie(t, s, "Alien", "", "1979-05-25", 9)
+	mustCreateMovie(t, s, "Heat", "", "1995-12-15", 8)
+	mustCreateMovie(t, s, "Aliens", "", "1986-07-18", 8)
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+	bana := mustCreateActor(t, s, "Eric Bana", "", "")
+	if err := s.CreateMovie(context.Background(), "Troy II", "", date("2006-01-01"), 1, storage.Credits(pitt, bana), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	if err := s.CreateMovie(context.Background(), "Snatch", "", date("2000-08-23"), 8, storage.Credits(pitt), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"-rating", []string{"Alien", "Heat", "Aliens", "Snatch", "Troy", "Troy II"}},
+		{"rating", []string{"Troy II", "Troy", "Heat", "Aliens", "Snatch", "Alien"}},
+		{"title", []string{"Alien", "Aliens", "Heat", "Snatch", "Troy", "Troy II"}},
+		{"-release_date", []string{"Troy II", "Troy", "Snatch", "Heat", "Aliens", "Alien"}},
+		{"-rating,title", []string{"Alien", "Aliens", "Heat", "Snatch", "Troy", "Troy II"}},
+		{"-rating,-title", []string{"Alien", "Snatch", "Heat", "Aliens", "Troy", "Troy II"}},
+		{"-actors,title", []string{"Troy II", "Snatch", "Alien", "Aliens", "Heat", "Troy"}},
+	}
+
+	for _, tt := range tests {
+		got := titles(mustGetMovies(t, s, tt.sort))
+		if !equal(got, tt.want) {
+			t.Errorf("sort %q: got %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func testLinks(t *testing.T, s storage.Storage) {
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+	norton := mustCreateActor(t, s, "Edward Norton", "", "")
+
+	if err := s.CreateMovie(context.Background(), "Fight Club", "", date("1999-09-10"), 10, storage.Credits(pitt, norton), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	if err := s.CreateMovie(context.Background(), "Troy", "", date("2004-05-14"), 7, storage.Credits(pitt), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+
+	movies := mustGetMovies(t, s, "title")
+	if got := names(movies[0].Actors); !sameSet(got, []string{"Brad Pitt", "Edward Norton"}) {
+		t.Errorf("Fight Club actors: got %v", got)
+	}
+	if got := names(movies[1].Actors); !sameSet(got, []string{"Brad Pitt"}) {
+		t.Errorf("Troy actors: got %v", got)
+	}
+
+	actors := mustGetActors(t, s)
+	if got := movieTitles(actorByID(t, actors, pitt).Movies); !sameSet(got, []string{"Fight Club", "Troy"}) {
+		t.Errorf("Brad Pitt movies: got %v", got)
+	}
+	if got := movieTitles(actorByID(t, actors, norton).Movies); !sameSet(got, []string{"Fight Club"}) {
+		t.Errorf("Edward Norton movies: got %v", got)
+	}
+}
+
+func testGetByID(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	pitt := mustCreateActor(t, s, "Brad Pitt", "male", "1963-12-18")
+	norton := mustCreateActor(t, s, "Edward Norton", "", "")
+	if err := s.CreateMovie(ctx, "Fight Club", "Insomniac meets soap maker", date("1999-09-10"), 10, storage.Credits(norton, pitt), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	id := mustGetMovies(t, s, "-rating")[0].ID
+
+	m, err := s.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if m.ID != id || m.Title != "Fight Club" || m.Release_date.String() != "1999-09-10" || m.Rating != 10 {
+		t.Errorf("unexpected movie %+v", m)
+	}
+	wantCast := []storage.ActorName{{ID: pitt, Name: "Brad Pitt"}, {ID: norton, Name: "Edward Norton"}}
+	if !slices.Equal(m.Actors, wantCast) {
+		t.Errorf("got cast %+v, want %+v", m.Actors, wantCast)
+	}
+
+	a, err := s.GetActor(ctx, pitt)
+	if err != nil {
+		t.Fatalf("GetActor: %v", err)
+	}
+	if a.ID != pitt || a.Name != "Brad Pitt" || a.Gender != "male" || a.Birthday.String() != "1963-12-18" {
+		t.Errorf("unexpected actor %+v", a)
+	}
+	if want := []storage.MovieTitle{{ID: id, Title: "Fight Club"}}; !slices.Equal(a.Movies, want) {
+		t.Errorf("got movies %+v, want %+v", a.Movies, want)
+	}
+
+	// The lists carry the same linked IDs.
+	if got := mustGetMovies(t, s, "-rating")[0].Actors; !slices.Equal(got, wantCast) {
+		t.Errorf("GetMovies cast: got %+v", got)
+	}
+
+	if _, err := s.GetMovie(ctx, id+1000); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetMovie of missing id: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetActor(ctx, -1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetActor of missing id: got %v, want ErrNotFound", err)
+	}
+}
+
+func testManageCast(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+	norton := mustCreateActor(t, s, "Edward Norton", "", "")
+	carter := mustCreateActor(t, s, "Helena Bonham Carter", "", "")
+	if err := s.CreateMovie(ctx, "Fight Club", "", date("1999"), 10, storage.Credits(pitt, pitt), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	id := mustGetMovies(t, s, "-rating")[0].ID
+
+	cast := func() []int {
+		t.Helper()
+		m, err := s.GetMovie(ctx, id)
+		if err != nil {
+			t.Fatalf("GetMovie: %v", err)
+		}
+		var ids []int
+		for _, a := range m.Actors {
+			ids = append(ids, a.ID)
+		}
+		return ids
+	}
+	if got := cast(); !slices.Equal(got, []int{pitt}) {
+		t.Errorf("duplicate ids on create: got cast %v, want [%d]", got, pitt)
+	}
+
+	steps := []struct {
+		name string
+		fn   func() error
+		want []int
+	}{
+		{"add", func() error { return s.AddMovieActors(ctx, id, 0, storage.Credits(norton, pitt)) }, []int{pitt, norton}},
+		{"add again", func() error { return s.AddMovieActors(ctx, id, 0, storage.Credits(norton)) }, []int{pitt, norton}},
+		{"remove", func() error { return s.RemoveMovieActors(ctx, id, 0, []int{pitt}) }, []int{norton}},
+		{"remove again", func() error { return s.RemoveMovieActors(ctx, id, 0, []int{pitt, 999999}) }, []int{norton}},
+		{"replace", func() error { return s.ReplaceMovieActors(ctx, id, 0, storage.Credits(carter, pitt, carter)) }, []int{pitt, carter}},
+		{"replace again", func() error { return s.ReplaceMovieActors(ctx, id, 0, storage.Credits(pitt, carter)) }, []int{pitt, carter}},
+	}
+	for _, step := range steps {
+		if err := step.fn(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := cast(); !slices.Equal(got, step.want) {
+			t.Errorf("%s: got cast %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	var unknownErr *storage.UnknownActorsError
+	if err := s.AddMovieActors(ctx, id, 0, storage.Credits(norton, 999999)); !errors.As(err, &unknownErr) {
+		t.Errorf("add unknown actor: got %v, want UnknownActorsError", err)
+	}
+	if err := s.ReplaceMovieActors(ctx, id, 0, storage.Credits(999999)); !errors.As(err, &unknownErr) {
+		t.Errorf("replace with unknown actor: got %v, want UnknownActorsError", err)
+	}
+	if got := cast(); !slices.Equal(got, []int{pitt, carter}) {
+		t.Errorf("failed changes left cast %v", got)
+	}
+
+	if err := s.ReplaceMovieActors(ctx, id, 0, nil); err != nil {
+		t.Fatalf("replace with nobody: %v", err)
+	}
+	if got := cast(); len(got) != 0 {
+		t.Errorf("replace with nobody: got cast %v", got)
+	}
+
+	if err := s.AddMovieActors(ctx, id+1000, 0, storage.Credits(pitt)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("add to missing movie: got %v, want ErrNotFound", err)
+	}
+	if err := s.RemoveMovieActors(ctx, id+1000, 0, []int{pitt}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("remove from missing movie: got %v, want ErrNotFound", err)
+	}
+	if err := s.ReplaceMovieActors(ctx, id+1000, 0, storage.Credits(pitt)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("replace on missing movie: got %v, want ErrNotFound", err)
+	}
+}
+
+func testCredits(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+	norton := mustCreateActor(t, s, "Edward Norton", "", "")
+	carter := mustCreateActor(t, s, "Helena Bonham Carter", "", "")
+	loaf := mustCreateActor(t, s, "Meat Loaf", "", "")
+
+	credits := []storage.Credit{
+		{ActorID: loaf, Part: storage.Part{Character: "Robert Paulson", Role: storage.RoleSupporting}},
+		{ActorID: carter, Part: storage.Part{Character: "Marla Singer", Billing: 3, Role: storage.RoleLead}},
+		{ActorID: pitt, Part: storage.Part{Character: "Tyler Durden", Billing: 2, Role: storage.RoleLead}},
+		{ActorID: norton, Part: storage.Part{Character: "The Narrator", Billing: 1, Role: storage.RoleLead}},
+	}
+	if err := s.CreateMovie(ctx, "Fight Club", "", date("1999-09-10"), 10, credits, nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	movies, err := s.GetMovies(ctx, storage.MovieFilter{}, nil, storage.Page{})
+	if err != nil || len(movies.Movies) != 1 {
+		t.Fatalf("GetMovies: got %v, %v", movies, err)
+	}
+	id := movies.Movies[0].ID
+
+	// Billed parts come first in billing order, unbilled ones last.
+	want := []storage.ActorName{
+		{ID: norton, Name: "Edward Norton", Part: credits[3].Part},
+		{ID: pitt, Name: "Brad Pitt", Part: credits[2].Part},
+		{ID: carter, Name: "Helena Bonham Carter", Part: credits[1].Part},
+		{ID: loaf, Name: "Meat Loaf", Part: credits[0].Part},
+	}
+	if got := movies.Movies[0].Actors; !slices.Equal(got, want) {
+		t.Errorf("GetMovies: got cast %+v, want %+v", got, want)
+	}
+	movie, err := s.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if !slices.Equal(movie.Actors, want) {
+		t.Errorf("GetMovie: got cast %+v, want %+v", movie.Actors, want)
+	}
+
+	actor, err := s.GetActor(ctx, pitt)
+	if err != nil {
+		t.Fatalf("GetActor: %v", err)
+	}
+	wantMovies := []storage.MovieTitle{{ID: id, Title: "Fight Club", Part: credits[2].Part}}
+	if !slices.Equal(actor.Movies, wantMovies) {
+		t.Errorf("GetActor: got movies %+v, want %+v", actor.Movies, wantMovies)
+	}
+
+	// Adding a linked actor again replaces the part; unbilled parts go by
+	// actor ID.
+	cameo := storage.Part{Character: "Himself", Role: storage.RoleCameo}
+	if err := s.AddMovieActors(ctx, id, 0, []storage.Credit{{ActorID: norton, Part: cameo}}); err != nil {
+		t.Fatalf("AddMovieActors: %v", err)
+	}
+	movie, err = s.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if len(movie.Actors) != 4 || movie.Actors[2].ID != norton || movie.Actors[2].Part != cameo {
+		t.Errorf("AddMovieActors did not replace the part: got cast %+v", movie.Actors)
+	}
+
+	bad := []storage.Credit{{ActorID: pitt, Part: storage.Part{Billing: -1}}}
+	if err := s.AddMovieActors(ctx, id, 0, bad); !errors.Is(err, storage.ErrInvalidCredit) {
+		t.Errorf("negative billing: got %v, want ErrInvalidCredit", err)
+	}
+	bad = []storage.Credit{{ActorID: pitt, Part: storage.Part{Role: "extra"}}}
+	if err := s.ReplaceMovieActors(ctx, id, 0, bad); !errors.Is(err, storage.ErrInvalidCredit) {
+		t.Errorf("unknown role: got %v, want ErrInvalidCredit", err)
+	}
+}
+
+func testUnknownActor(t *testing.T, s storage.Storage) {
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+
+	err := s.CreateMovie(context.Background(), "Fight Club", "", date("1999-09-10"), 10, storage.Credits(-1, pitt, 999999, -1), nil)
+
+	var unknownErr *storage.UnknownActorsError
+	if !errors.As(err, &unknownErr) {
+		t.Fatalf("CreateMovie with unknown actors: got %v, want UnknownActorsError", err)
+	}
+	if !slices.Equal(unknownErr.IDs, []int{-1, 999999}) {
+		t.Errorf("got unknown ids %v, want [-1 999999]", unknownErr.IDs)
+	}
+	if !errors.Is(err, storage.ErrValidation) {
+		t.Errorf("UnknownActorsError does not wrap ErrValidation")
+	}
+
+	// Nothing of the movie may be left behind.
+	if movies := mustGetMovies(t, s, "-rating"); len(movies) != 0 {
+		t.Errorf("got %d movies after failed create, want 0", len(movies))
+	}
+	if got := actorByID(t, mustGetActors(t, s), pitt).Movies; len(got) != 0 {
+		t.Errorf("actor linked to %v after failed create", got)
+	}
+}
+
+func testDeleteMovieCascades(t *testing.T, s storage.Storage) {
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+	if err := s.CreateMovie(context.Background(), "Fight Club", "", date("1999-09-10"), 10, storage.Credits(pitt), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	movie := mustGetMovies(t, s, "-rating")[0]
+
+	if err := s.DeleteMovie(context.Background(), movie.ID, 0); err != nil {
+		t.Fatalf("DeleteMovie: %v", err)
+	}
+
+	if movies := mustGetMovies(t, s, "-rating"); len(movies) != 0 {
+		t.Errorf("got %d movies after delete, want 0", len(movies))
+	}
+	if got := actorByID(t, mustGetActors(t, s), pitt).Movies; len(got) != 0 {
+		t.Errorf("actor still linked to %v", got)
+	}
+}
+
+func testDeleteActorCascades(t *testing.T, s storage.Storage) {
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+	if err := s.CreateMovie(context.Background(), "Fight Club", "", date("1999-09-10"), 10, storage.Credits(pitt), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+
+	if err := s.DeleteActor(context.Background(), pitt, 0); err != nil {
+		t.Fatalf("DeleteActor: %v", err)
+	}
+
+	if actors := mustGetActors(t, s); len(actors) != 0 {
+		t.Errorf("got %d actors after delete, want 0", len(actors))
+	}
+	if got := mustGetMovies(t, s, "-rating")[0].Actors; len(got) != 0 {
+		t.Errorf("movie still linked to %v", got)
+	}
+}
+
+func testUpdateMovie(t *testing.T, s storage.Storage) {
+	mustCreateMovie(t, s, "Fight Club", "old", "1999-09-10", 5)
+	id := mustGetMovies(t, s, "-rating")[0].ID
+
+	if err := s.UpdateMovie(context.Background(), id, 0, "", "new", date(""), 9); err != nil {
+		t.Fatalf("UpdateMovie: %v", err)
+	}
+
+	m := mustGetMovies(t, s, "-rating")[0]
+	if m.Title != "Fight Club" || m.Description != "new" || m.Release_date.String() != "1999-09-10" || m.Rating != 9 {
+		t.Errorf("unexpected movie after update %+v", m)
+	}
+}
+
+func testUpdateActor(t *testing.T, s storage.Storage) {
+	id := mustCreateActor(t, s, "Brad Pitt", "male", "1963-12-18")
+
+	if err := s.UpdateActor(context.Background(), id, 0, "William Bradley Pitt", "", date("")); err != nil {
+		t.Fatalf("UpdateActor: %v", err)
+	}
+
+	a := actorByID(t, mustGetActors(t, s), id)
+	if a.Name != "William Bradley Pitt" || a.Gender != "male" || a.Birthday.String() != "1963-12-18" {
+		t.Errorf("unexpected actor after update %+v", a)
+	}
+}
+
+func testUpdateWithoutFields(t *testing.T, s storage.Storage) {
+	mustCreateMovie(t, s, "Fight Club", "", "1999-09-10", 10)
+	movieID := mustGetMovies(t, s, "-rating")[0].ID
+	actorID := mustCreateActor(t, s, "Brad Pitt", "", "")
+
+	if err := s.UpdateMovie(context.Background(), movieID, 0, "", "", date(""), 0); err == nil {
+		t.Error("UpdateMovie without fields: got nil error")
+	}
+	if err := s.UpdateActor(context.Background(), actorID, 0, "", "", date("")); err == nil {
+		t.Error("UpdateActor without fields: got nil error")
+	}
+}
+
+func testPatchMovie(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustCreateMovie(t, s, "Fight Club", "old", "1999-09-10", 5)
+	id := mustGetMovies(t, s, "-rating")[0].ID
+
+	// Zero values are set, null clears and absent fields are left as they are.
+	patch := storage.MoviePatch{
+		Description:  storage.Optional[string]{Set: true, Null: true},
+		Release_date: storage.Optional[storage.Date]{Set: true, Null: true},
+		Rating:       storage.Of(0),
+	}
+	if err := s.PatchMovie(ctx, id, 0, patch); err != nil {
+		t.Fatalf("PatchMovie: %v", err)
+	}
+
+	m, err := s.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if m.Title != "Fight Club" || m.Description != "" || !m.Release_date.IsZero() || m.Rating != 0 {
+		t.Errorf("unexpected movie after patch %+v", m)
+	}
+
+	if err := s.PatchMovie(ctx, id, 0, storage.MoviePatch{}); err != nil {
+		t.Errorf("PatchMovie without fields: %v", err)
+	}
+	if err := s.PatchMovie(ctx, id+1, 0, storage.MoviePatch{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("PatchMovie of a missing movie: got %v, want ErrNotFound", err)
+	}
+	if err := s.PatchMovie(ctx, id+1, 0, storage.MoviePatch{Title: storage.Of("Heat")}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("PatchMovie of a missing movie: got %v, want ErrNotFound", err)
+	}
+	if err := s.PatchMovie(ctx, id, 0, storage.MoviePatch{Rating: storage.Of(11)}); !errors.Is(err, storage.ErrValidation) {
+		t.Errorf("PatchMovie with rating 11: got %v, want ErrValidation", err)
+	}
+}
+
+func testPatchPerson(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	id := mustCreateActor(t, s, "Brad Pitt", "male", "1963-12-18")
+
+	patch := storage.PersonPatch{
+		Gender:   storage.Optional[string]{Set: true, Null: true},
+		Birthday: storage.Optional[storage.Date]{Set: true, Null: true},
+		KnownFor: storage.Of(storage.DepartmentProduction),
+	}
+	if err := s.PatchPerson(ctx, id, 0, patch); err != nil {
+		t.Fatalf("PatchPerson: %v", err)
+	}
+
+	p, err := s.GetPerson(ctx, id)
+	if err != nil {
+		t.Fatalf("GetPerson: %v", err)
+	}
+	if p.Name != "Brad Pitt" || p.Gender != "" || !p.Birthday.IsZero() || p.KnownFor != storage.DepartmentProduction {
+		t.Errorf("unexpected person after patch %+v", p)
+	}
+
+	if err := s.PatchPerson(ctx, id+1, 0, storage.PersonPatch{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("PatchPerson of a missing person: got %v, want ErrNotFound", err)
+	}
+}
+
+func testVersions(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustCreateMovie(t, s, "Fight Club", "", "1999-09-10", 8)
+	movieID := mustGetMovies(t, s, "-rating")[0].ID
+	actorID := mustCreateActor(t, s, "Brad Pitt", "male", "1963-12-18")
+
+	versions := func() (movie, actor int) {
+		t.Helper()
+		m, err := s.GetMovie(ctx, movieID)
+		if err != nil {
+			t.Fatalf("GetMovie: %v", err)
+		}
+		a, err := s.GetActor(ctx, actorID)
+		if err != nil {
+			t.Fatalf("GetActor: %v", err)
+		}
+		return m.Version, a.Version
+	}
+
+	if m, a := versions(); m != 1 || a != 1 {
+		t.Fatalf("new versions %d and %d, want 1", m, a)
+	}
+	if err := s.UpdateMovie(ctx, movieID, 2, "", "new", storage.Date{}, 0); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Errorf("UpdateMovie of version 2: got %v, want ErrVersionMismatch", err)
+	}
+	if err := s.UpdateMovie(ctx, movieID, 1, "", "new", storage.Date{}, 0); err != nil {
+		t.Fatalf("UpdateMovie of version 1: %v", err)
+	}
+	if m, a := versions(); m != 2 || a != 1 {
+		t.Errorf("versions after update %d and %d, want 2 and 1", m, a)
+	}
+
+	// A change of the cast changes both sides.
+	if err := s.AddMovieActors(ctx, movieID, 0, []storage.Credit{{ActorID: actorID}}); err != nil {
+		t.Fatalf("AddMovieActors: %v", err)
+	}
+	m, a := versions()
+	if m != 3 || a != 2 {
+		t.Errorf("versions after cast change %d and %d, want 3 and 2", m, a)
+	}
+	if err := s.PatchPerson(ctx, actorID, 1, storage.PersonPatch{Name: storage.Of("William Bradley Pitt")}); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Errorf("PatchPerson of version 1: got %v, want ErrVersionMismatch", err)
+	}
+	if err := s.PatchPerson(ctx, actorID, a, storage.PersonPatch{Name: storage.Of("William Bradley Pitt")}); err != nil {
+		t.Fatalf("PatchPerson of version %d: %v", a, err)
+	}
+	if got, _ := versions(); got != m+1 {
+		t.Errorf("movie version after renaming its actor %d, want %d", got, m+1)
+	}
+
+	// Changes to the links of a movie are made against its version too.
+	m, _ = versions()
+	links := []struct {
+		name   string
+		change func(version int) error
+	}{
+		{"AddMovieActors", func(v int) error { return s.AddMovieActors(ctx, movieID, v, storage.Credits(actorID)) }},
+		{"RemoveMovieActors", func(v int) error { return s.RemoveMovieActors(ctx, movieID, v, []int{actorID}) }},
+		{"ReplaceMovieActors", func(v int) error { return s.ReplaceMovieActors(ctx, movieID, v, storage.Credits(actorID)) }},
+		{"SetMovieGenres", func(v int) error { return s.SetMovieGenres(ctx, movieID, v, nil) }},
+		{"ReplaceMovieCrew", func(v int) error { return s.ReplaceMovieCrew(ctx, movieID, v, nil) }},
+	}
+	for _, l := range links {
+		if err := l.change(1); !errors.Is(err, storage.ErrVersionMismatch) {
+			t.Errorf("%s of version 1: got %v, want ErrVersionMismatch", l.name, err)
+		}
+	}
+	if got, _ := versions(); got != m {
+		t.Errorf("movie version after mismatched changes %d, want %d", got, m)
+	}
+	if err := s.SetMovieGenres(ctx, movieID, m, nil); err != nil {
+		t.Fatalf("SetMovieGenres of version %d: %v", m, err)
+	}
+
+	if err := s.DeleteMovie(ctx, movieID, 1); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Errorf("DeleteMovie of version 1: got %v, want ErrVersionMismatch", err)
+	}
+	if err := s.DeleteMovie(ctx, movieID, 0); err != nil {
+		t.Fatalf("DeleteMovie: %v", err)
+	}
+}
+
+func testPartialDates(t *testing.T, s storage.Storage) {
+	mustCreateMovie(t, s, "Metropolis", "", "1927", 8)
+	mustCreateMovie(t, s, "Nosferatu", "", "1922-03", 7)
+	mustCreateMovie(t, s, "Sunrise", "", "1927-09-23", 9)
+	mustCreateMovie(t, s, "Lost Film", "", "", 5)
+	mustCreateActor(t, s, "Max Schreck", "male", "1879-09")
+
+	got := make(map[string]string)
+	for _, m := range mustGetMovies(t, s, "-rating") {
+		got[m.Title] = m.Release_date.String()
+	}
+	want := map[string]string{"Metropolis": "1927", "Nosferatu": "1922-03", "Sunrise": "1927-09-23", "Lost Film": ""}
+	for title, d := range want {
+		if got[title] != d {
+			t.Errorf("%s: got release date %q, want %q", title, got[title], d)
+		}
+	}
+	if a := mustGetActors(t, s)[0]; a.Birthday.String() != "1879-09" {
+		t.Errorf("got birthday %q, want 1879-09", a.Birthday)
+	}
+
+	// Partial dates sort by their first day, missing dates first.
+	if got := titles(mustGetMovies(t, s, "release_date")); !equal(got, []string{"Lost Film", "Nosferatu", "Metropolis", "Sunrise"}) {
+		t.Errorf("sort release_date: got %v", got)
+	}
+
+	first := mustGetMoviesPage(t, s, "-release_date", storage.Page{Limit: 2})
+	second := mustGetMoviesPage(t, s, "-release_date", storage.Page{Limit: 2, After: first.NextCursor})
+	if got := titles(second.Movies); !equal(got, []string{"Nosferatu", "Lost Film"}) {
+		t.Errorf("second page by -release_date: got %v", got)
+	}
+}
+
+func testDateFilters(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustCreateMovie(t, s, "Alien", "", "1979-05-25", 9)
+	mustCreateMovie(t, s, "Heat", "", "1995-12", 8)
+	mustCreateMovie(t, s, "Fight Club", "", "1999", 10)
+	mustCreateMovie(t, s, "Troy", "", "2004-05-14", 7)
+	mustCreateMovie(t, s, "Lost Film", "", "", 5)
+	mustCreateActor(t, s, "Brad Pitt", "", "1963-12-18")
+	mustCreateActor(t, s, "Edward Norton", "", "1969-08")
+	mustCreateActor(t, s, "Anna Karina", "", "1940")
+	mustCreateActor(t, s, "Unknown", "", "")
+
+	movieTests := []struct {
+		filter storage.MovieFilter
+		want   []string
+	}{
+		{storage.MovieFilter{ReleasedAfter: date("1995")}, []string{"Heat", "Fight Club", "Troy"}},
+		{storage.MovieFilter{ReleasedBefore: date("1995")}, []string{"Alien", "Heat"}},
+		{storage.MovieFilter{ReleasedAfter: date("1995-12-15"), ReleasedBefore: date("2004-05")}, []string{"Fight Club", "Troy"}},
+		{storage.MovieFilter{ReleasedAfter: date("2005")}, nil},
+	}
+	for _, tt := range movieTests {
+		res, err := s.GetMovies(ctx, tt.filter, storage.ParseSort("release_date"), storage.Page{})
+		if err != nil {
+			t.Fatalf("GetMovies(%+v): %v", tt.filter, err)
+		}
+		if got := titles(res.Movies); !equal(got, tt.want) || res.Total != len(tt.want) {
+			t.Errorf("GetMovies(%+v): got %v (total %d), want %v", tt.filter, got, res.Total, tt.want)
+		}
+	}
+
+	res, err := s.SearchMovies(ctx, "heat", storage.MovieFilter{ReleasedAfter: date("1996")}, nil, storage.Page{})
+	if err != nil {
+		t.Fatalf("SearchMovies: %v", err)
+	}
+	if res.Total != 0 {
+		t.Errorf("SearchMovies(heat) after 1996: got %+v", res.Results)
+	}
+
+	actors, err := s.GetActors(ctx, storage.ActorFilter{BornAfter: date("1960"), BornBefore: date("1969-08-01")},
+		storage.ParseSort("birthday"), storage.Page{})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	var got []string
+	for _, a := range actors.Actors {
+		got = append(got, a.Name)
+	}
+	if !equal(got, []string{"Brad Pitt", "Edward Norton"}) || actors.Total != 2 {
+		t.Errorf("actors born 1960 to 1969-08-01: got %v (total %d)", got, actors.Total)
+	}
+}
+
+func testGenres(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	drama := mustCreateGenre(t, s, "Drama")
+	thriller := mustCreateGenre(t, s, "Thriller")
+
+	if err := s.CreateGenre(ctx, "drama"); !errors.Is(err, storage.ErrGenreExists) || !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("CreateGenre(drama): got %v, want ErrGenreExists, a conflict", err)
+	}
+	if err := s.UpdateGenre(ctx, thriller, "DRAMA"); !errors.Is(err, storage.ErrGenreExists) {
+		t.Errorf("UpdateGenre to DRAMA: got %v, want ErrGenreExists", err)
+	}
+	if err := s.UpdateGenre(ctx, thriller+1000, "Noir"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UpdateGenre of missing genre: got %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateGenre(ctx, thriller, "Crime"); err != nil {
+		t.Fatalf("UpdateGenre: %v", err)
+	}
+	genre, err := s.GetGenre(ctx, thriller)
+	if err != nil || genre.Name != "Crime" {
+		t.Errorf("GetGenre after rename: got %+v, %v", genre, err)
+	}
+	if _, err := s.GetGenre(ctx, thriller+1000); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetGenre of missing genre: got %v, want ErrNotFound", err)
+	}
+
+	var unknownErr *storage.UnknownGenresError
+	err = s.CreateMovie(ctx, "Fight Club", "", date("1999"), 10, nil, []int{drama, 999999})
+	if !errors.As(err, &unknownErr) || !slices.Equal(unknownErr.IDs, []int{999999}) {
+		t.Fatalf("CreateMovie with unknown genre: got %v, want UnknownGenresError", err)
+	}
+	if movies := mustGetMovies(t, s, "title"); len(movies) != 0 {
+		t.Fatalf("failed CreateMovie left %v", titles(movies))
+	}
+
+	if err := s.CreateMovie(ctx, "Fight Club", "", date("1999"), 10, nil, []int{thriller, drama, drama}); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	id := mustGetMovies(t, s, "title")[0].ID
+	movie, err := s.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	want := []storage.Genre{{ID: thriller, Name: "Crime"}, {ID: drama, Name: "Drama"}}
+	if !slices.Equal(movie.Genres, want) {
+		t.Errorf("GetMovie: got genres %+v, want %+v", movie.Genres, want)
+	}
+
+	if err := s.SetMovieGenres(ctx, id, 0, []int{drama}); err != nil {
+		t.Fatalf("SetMovieGenres: %v", err)
+	}
+	if err := s.SetMovieGenres(ctx, id, 0, []int{999999}); !errors.As(err, &unknownErr) {
+		t.Errorf("SetMovieGenres with unknown genre: got %v, want UnknownGenresError", err)
+	}
+	if err := s.SetMovieGenres(ctx, id+1000, 0, []int{drama}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetMovieGenres of missing movie: got %v, want ErrNotFound", err)
+	}
+	genres, err := s.GetGenres(ctx)
+	if err != nil {
+		t.Fatalf("GetGenres: %v", err)
+	}
+	wantCounts := []storage.GenreCount{{Genre: storage.Genre{ID: thriller, Name: "Crime"}}, {Genre: storage.Genre{ID: drama, Name: "Drama"}, Count: 1}}
+	if !slices.Equal(genres, wantCounts) {
+		t.Errorf("GetGenres: got %+v, want %+v", genres, wantCounts)
+	}
+
+	if err := s.DeleteGenre(ctx, drama); err != nil {
+		t.Fatalf("DeleteGenre: %v", err)
+	}
+	movie, err = s.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if len(movie.Genres) != 0 {
+		t.Errorf("DeleteGenre left the movie in %+v", movie.Genres)
+	}
+}
+
+func testGenreFilters(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	drama := mustCreateGenre(t, s, "Drama")
+	thriller := mustCreateGenre(t, s, "Thriller")
+	crime := mustCreateGenre(t, s, "Crime")
+	movies := []struct {
+		title  string
+		genres []int
+	}{
+		{"Fight Club", []int{drama, thriller}},
+		{"Heat", []int{crime, drama, thriller}},
+		{"Se7en", []int{crime, thriller}},
+		{"Amelie", nil},
+	}
+	for _, m := range movies {
+		if err := s.CreateMovie(ctx, m.title, "", date("2000"), 8, nil, m.genres); err != nil {
+			t.Fatalf("CreateMovie(%s): %v", m.title, err)
+		}
+	}
+
+	tests := []struct {
+		filter storage.MovieFilter
+		want   []string
+	}{
+		{storage.MovieFilter{Genres: []string{"drama"}}, []string{"Fight Club", "Heat"}},
+		{storage.MovieFilter{Genres: []string{"Drama", "crime"}}, []string{"Fight Club", "Heat", "Se7en"}},
+		{storage.MovieFilter{Genres: []string{"drama", "CRIME", "drama"}, AllGenres: true}, []string{"Heat"}},
+		{storage.MovieFilter{Genres: []string{"drama", "western"}, AllGenres: true}, nil},
+		{storage.MovieFilter{Genres: []string{"western"}}, nil},
+		{storage.MovieFilter{Genres: []string{" "}}, []string{"Amelie", "Fight Club", "Heat", "Se7en"}},
+	}
+	for _, tt := range tests {
+		res, err := s.GetMovies(ctx, tt.filter, storage.ParseSort("title"), storage.Page{})
+		if err != nil {
+			t.Fatalf("GetMovies(%+v): %v", tt.filter, err)
+		}
+		if got := titles(res.Movies); !equal(got, tt.want) || res.Total != len(tt.want) {
+			t.Errorf("GetMovies(%+v): got %v (total %d), want %v", tt.filter, got, res.Total, tt.want)
+		}
+	}
+
+	// The facet counts every movie that matches the filter, not just the page.
+	res, err := s.GetMovies(ctx, storage.MovieFilter{Genres: []string{"thriller"}}, storage.ParseSort("title"), storage.Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetMovies: %v", err)
+	}
+	wantFacet := []storage.GenreCount{
+		{Genre: storage.Genre{ID: thriller, Name: "Thriller"}, Count: 3},
+		{Genre: storage.Genre{ID: crime, Name: "Crime"}, Count: 2},
+		{Genre: storage.Genre{ID: drama, Name: "Drama"}, Count: 2},
+	}
+	if !slices.Equal(res.Genres, wantFacet) {
+		t.Errorf("GetMovies facet: got %+v, want %+v", res.Genres, wantFacet)
+	}
+
+	search, err := s.SearchMovies(ctx, "heat", storage.MovieFilter{Genres: []string{"crime", "drama"}, AllGenres: true}, nil, storage.Page{})
+	if err != nil {
+		t.Fatalf("SearchMovies: %v", err)
+	}
+	if search.Total != 1 || search.Results[0].Title != "Heat" || len(search.Results[0].Genres) != 3 {
+		t.Errorf("SearchMovies(heat) in crime and drama: got %+v", search.Results)
+	}
+	search, err = s.SearchMovies(ctx, "heat", storage.MovieFilter{Genres: []string{"western"}}, nil, storage.Page{})
+	if err != nil {
+		t.Fatalf("SearchMovies: %v", err)
+	}
+	if search.Total != 0 {
+		t.Errorf("SearchMovies(heat) in western: got %+v", search.Results)
+	}
+}
+
+func testPeople(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	nolan := mustCreatePerson(t, s, "Christopher Nolan", storage.DepartmentDirecting)
+	mustCreateMovie(t, s, "Memento", "", "2000-09-05", 8)
+	mustCreateMovie(t, s, "Inception", "", "2010-07-08", 9)
+	mustCreateMovie(t, s, "Untitled", "", "", 0)
+	movies := mustGetMovies(t, s, "title")
+	inception, memento, untitled := movies[0].ID, movies[1].ID, movies[2].ID
+
+	// A director is a person, but not an actor until cast in a movie.
+	if len(mustGetActors(t, s)) != 0 {
+		t.Errorf("GetActors lists a director: %+v", mustGetActors(t, s))
+	}
+	if _, err := s.GetActor(ctx, nolan); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetActor of a director: got %v, want ErrNotFound", err)
+	}
+
+	directing := storage.CrewCredit{PersonID: nolan, Department: storage.DepartmentDirecting, Job: "Director"}
+	writing := storage.CrewCredit{PersonID: nolan, Department: storage.DepartmentWriting, Job: "Screenplay"}
+	story := storage.CrewCredit{PersonID: nolan, Department: storage.DepartmentWriting, Job: "Story"}
+	if err := s.ReplaceMovieCrew(ctx, memento, 0, []storage.CrewCredit{writing, directing}); err != nil {
+		t.Fatalf("ReplaceMovieCrew: %v", err)
+	}
+	if err := s.ReplaceMovieCrew(ctx, inception, 0, []storage.CrewCredit{directing, writing}); err != nil {
+		t.Fatalf("ReplaceMovieCrew: %v", err)
+	}
+	if err := s.ReplaceMovieCrew(ctx, untitled, 0, []storage.CrewCredit{story}); err != nil {
+		t.Fatalf("ReplaceMovieCrew: %v", err)
+	}
+	cameo := storage.Part{Character: "Himself", Role: storage.RoleCameo}
+	if err := s.AddMovieActors(ctx, inception, 0, []storage.Credit{{ActorID: nolan, Part: cameo}}); err != nil {
+		t.Fatalf("AddMovieActors: %v", err)
+	}
+
+	actor, err := s.GetActor(ctx, nolan)
+	if err != nil {
+		t.Fatalf("GetActor of a cast director: %v", err)
+	}
+	if want := []storage.MovieTitle{{ID: inception, Title: "Inception", Part: cameo}}; !slices.Equal(actor.Movies, want) {
+		t.Errorf("GetActor: got movies %+v, want %+v", actor.Movies, want)
+	}
+
+	person, err := s.GetPerson(ctx, nolan)
+	if err != nil {
+		t.Fatalf("GetPerson: %v", err)
+	}
+	if person.Name != "Christopher Nolan" || person.KnownFor != storage.DepartmentDirecting {
+		t.Errorf("GetPerson: got %+v", person.Person)
+	}
+	// Departments come in a fixed order, newest movies first and undated
+	// ones last.
+	want := []storage.DepartmentCredits{
+		{Department: storage.DepartmentActing, Credits: []storage.FilmCredit{
+			{ID: inception, Title: "Inception", Release_date: date("2010-07-08"), Part: cameo},
+		}},
+		{Department: storage.DepartmentDirecting, Credits: []storage.FilmCredit{
+			{ID: inception, Title: "Inception", Release_date: date("2010-07-08"), Job: "Director"},
+			{ID: memento, Title: "Memento", Release_date: date("2000-09-05"), Job: "Director"},
+		}},
+		{Department: storage.DepartmentWriting, Credits: []storage.FilmCredit{
+			{ID: inception, Title: "Inception", Release_date: date("2010-07-08"), Job: "Screenplay"},
+			{ID: memento, Title: "Memento", Release_date: date("2000-09-05"), Job: "Screenplay"},
+			{ID: untitled, Title: "Untitled", Job: "Story"},
+		}},
+	}
+	if !slices.EqualFunc(person.Filmography, want, func(a, b storage.DepartmentCredits) bool {
+		return a.Department == b.Department && slices.Equal(a.Credits, b.Credits)
+	}) {
+		t.Errorf("GetPerson: got filmography %+v, want %+v", person.Filmography, want)
+	}
+	if _, err := s.GetPerson(ctx, nolan+1000); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetPerson of missing person: got %v, want ErrNotFound", err)
+	}
+
+	if err := s.DeletePerson(ctx, nolan, 0); err != nil {
+		t.Fatalf("DeletePerson: %v", err)
+	}
+	movie, err := s.GetMovie(ctx, inception)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if len(movie.Actors) != 0 || len(movie.Crew) != 0 {
+		t.Errorf("DeletePerson left cast %+v and crew %+v", movie.Actors, movie.Crew)
+	}
+}
+
+func testCrew(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	nolan := mustCreatePerson(t, s, "Christopher Nolan", storage.DepartmentDirecting)
+	zimmer := mustCreatePerson(t, s, "Hans Zimmer", storage.DepartmentSound)
+	pfister := mustCreatePerson(t, s, "Wally Pfister", storage.DepartmentCamera)
+	mustCreateMovie(t, s, "Inception", "", "2010-07-08", 9)
+	id := mustGetMovies(t, s, "title")[0].ID
+
+	crew := []storage.CrewCredit{
+		{PersonID: zimmer, Department: storage.DepartmentSound, Job: "Original Music Composer"},
+		{PersonID: pfister, Department: storage.DepartmentCamera, Job: "Director of Photography"},
+		{PersonID: nolan, Department: storage.DepartmentWriting, Job: "Writer"},
+		{PersonID: nolan, Department: storage.DepartmentDirecting, Job: "Director"},
+		{PersonID: nolan, Department: storage.DepartmentDirecting, Job: "Director"},
+	}
+	if err := s.ReplaceMovieCrew(ctx, id, 0, crew); err != nil {
+		t.Fatalf("ReplaceMovieCrew: %v", err)
+	}
+	want := []storage.CrewMember{
+		{ID: nolan, Name: "Christopher Nolan", Department: storage.DepartmentDirecting, Job: "Director"},
+		{ID: nolan, Name: "Christopher Nolan", Department: storage.DepartmentWriting, Job: "Writer"},
+		{ID: pfister, Name: "Wally Pfister", Department: storage.DepartmentCamera, Job: "Director of Photography"},
+		{ID: zimmer, Name: "Hans Zimmer", Department: storage.DepartmentSound, Job: "Original Music Composer"},
+	}
+	movie, err := s.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if !slices.Equal(movie.Crew, want) {
+		t.Errorf("GetMovie: got crew %+v, want %+v", movie.Crew, want)
+	}
+	if got := mustGetMovies(t, s, "title")[0].Crew; !slices.Equal(got, want) {
+		t.Errorf("GetMovies: got crew %+v, want %+v", got, want)
+	}
+
+	var unknownErr *storage.UnknownPeopleError
+	unknown := []storage.CrewCredit{{PersonID: 999999, Department: storage.DepartmentArt}}
+	if err := s.ReplaceMovieCrew(ctx, id, 0, unknown); !errors.As(err, &unknownErr) || !slices.Equal(unknownErr.IDs, []int{999999}) {
+		t.Errorf("ReplaceMovieCrew with unknown person: got %v, want UnknownPeopleError", err)
+	}
+	acting := []storage.CrewCredit{{PersonID: nolan, Department: storage.DepartmentActing}}
+	if err := s.ReplaceMovieCrew(ctx, id, 0, acting); !errors.Is(err, storage.ErrInvalidCredit) || !errors.Is(err, storage.ErrValidation) {
+		t.Errorf("acting crew credit: got %v, want ErrInvalidCredit, a validation error", err)
+	}
+	if err := s.ReplaceMovieCrew(ctx, id+1000, 0, crew); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("ReplaceMovieCrew of missing movie: got %v, want ErrNotFound", err)
+	}
+
+	// Failed replacements keep the crew; a successful one drops the rest.
+	if err := s.ReplaceMovieCrew(ctx, id, 0, crew[:1]); err != nil {
+		t.Fatalf("ReplaceMovieCrew: %v", err)
+	}
+	movie, err = s.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if !slices.Equal(movie.Crew, want[3:]) {
+		t.Errorf("ReplaceMovieCrew: got crew %+v, want %+v", movie.Crew, want[3:])
+	}
+
+	if err := s.DeleteMovie(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteMovie: %v", err)
+	}
+	person, err := s.GetPerson(ctx, zimmer)
+	if err != nil {
+		t.Fatalf("GetPerson: %v", err)
+	}
+	if len(person.Filmography) != 0 {
+		t.Errorf("DeleteMovie left filmography %+v", person.Filmography)
+	}
+}
+
+func testUsers(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	if _, err := s.GetUserByName(ctx, "admin"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetUserByName of missing user: got %v, want ErrNotFound", err)
+	}
+
+	hash, err := storage.HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if err := s.CreateUser(ctx, "Admin", hash, storage.UserRoleEditor); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := s.CreateUser(ctx, "admin", hash, storage.UserRoleViewer); !errors.Is(err, storage.ErrUserExists) || !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("CreateUser(admin): got %v, want ErrUserExists, a conflict", err)
+	}
+
+	user, err := s.GetUserByName(ctx, "ADMIN")
+	if err != nil {
+		t.Fatalf("GetUserByName: %v", err)
+	}
+	if user.Username != "Admin" || user.Role != storage.UserRoleEditor || user.Disabled || user.CreatedAt.IsZero() {
+		t.Errorf("GetUserByName: got %+v", user)
+	}
+	if !user.CheckPassword("correct horse") || user.CheckPassword("battery staple") {
+		t.Errorf("CheckPassword does not match the hashed password")
+	}
+
+	hash, err = storage.HashPassword("battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if err := s.SetUserPassword(ctx, user.ID, hash); err != nil {
+		t.Fatalf("SetUserPassword: %v", err)
+	}
+	if err := s.SetUserDisabled(ctx, user.ID, true); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+	if err := s.SetUserRole(ctx, user.ID, storage.UserRoleAdmin); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	users, err := s.GetUsers(ctx)
+	if err != nil || len(users) != 1 {
+		t.Fatalf("GetUsers: got %+v, %v", users, err)
+	}
+	if !users[0].Disabled || users[0].Role != storage.UserRoleAdmin || !users[0].CheckPassword("battery staple") {
+		t.Errorf("GetUsers: got %+v after disabling and changing the password and role", users[0])
+	}
+
+	if err := s.SetUserPassword(ctx, user.ID+1000, hash); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetUserPassword of missing user: got %v, want ErrNotFound", err)
+	}
+	if err := s.SetUserDisabled(ctx, user.ID+1000, true); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetUserDisabled of missing user: got %v, want ErrNotFound", err)
+	}
+	if err := s.SetUserRole(ctx, user.ID+1000, storage.UserRoleAdmin); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetUserRole of missing user: got %v, want ErrNotFound", err)
+	}
+}
+
+func testTokens(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	if err := s.CreateUser(ctx, "reader", []byte("hash"), storage.UserRoleViewer); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := s.GetUserByName(ctx, "reader")
+	if err != nil {
+		t.Fatalf("GetUserByName: %v", err)
+	}
+	if got, err := s.GetUser(ctx, user.ID); err != nil || got.Username != "reader" {
+		t.Errorf("GetUser: got %+v, %v", got, err)
+	}
+	if _, err := s.GetUser(ctx, user.ID+1000); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetUser of missing user: got %v, want ErrNotFound", err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	token := func(hash string) storage.RefreshToken {
+		return storage.RefreshToken{Hash: hash, UserID: user.ID, Family: "family", ExpiresAt: expires}
+	}
+	if err := s.CreateRefreshToken(ctx, token("a")); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	next, err := s.RotateRefreshToken(ctx, "a", storage.RefreshToken{Hash: "b", ExpiresAt: expires})
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if next.UserID != user.ID || next.Family != "family" {
+		t.Errorf("RotateRefreshToken: got %+v, want the user and family of the old token", next)
+	}
+	if _, err := s.RotateRefreshToken(ctx, "missing", storage.RefreshToken{Hash: "c", ExpiresAt: expires}); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Errorf("RotateRefreshToken of unknown token: got %v, want ErrInvalidToken", err)
+	}
+
+	// Reusing a rotated token revokes the tokens rotated from it too.
+	if _, err := s.RotateRefreshToken(ctx, "a", storage.RefreshToken{Hash: "d", ExpiresAt: expires}); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Errorf("RotateRefreshToken of reused token: got %v, want ErrInvalidToken", err)
+	}
+	if _, err := s.RotateRefreshToken(ctx, "b", storage.RefreshToken{Hash: "e", ExpiresAt: expires}); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Errorf("RotateRefreshToken after reuse: got %v, want ErrInvalidToken", err)
+	}
+
+	expired := token("f")
+	expired.Family, expired.ExpiresAt = "expired", time.Now().Add(-time.Minute)
+	if err := s.CreateRefreshToken(ctx, expired); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	if _, err := s.RotateRefreshToken(ctx, "f", storage.RefreshToken{Hash: "g", ExpiresAt: expires}); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Errorf("RotateRefreshToken of expired token: got %v, want ErrInvalidToken", err)
+	}
+
+	signedIn := token("h")
+	signedIn.Family = "signed in"
+	if err := s.CreateRefreshToken(ctx, signedIn); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	if err := s.RevokeRefreshTokens(ctx, "h"); err != nil {
+		t.Fatalf("RevokeRefreshTokens: %v", err)
+	}
+	if _, err := s.RotateRefreshToken(ctx, "h", storage.RefreshToken{Hash: "i", ExpiresAt: expires}); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Errorf("RotateRefreshToken of revoked token: got %v, want ErrInvalidToken", err)
+	}
+	if err := s.RevokeRefreshTokens(ctx, "missing"); err != nil {
+		t.Errorf("RevokeRefreshTokens of unknown token: %v", err)
+	}
+
+	if revoked, err := s.AccessTokenRevoked(ctx, "jti"); err != nil || revoked {
+		t.Errorf("AccessTokenRevoked before revoking: got %v, %v", revoked, err)
+	}
+	for range 2 {
+		if err := s.RevokeAccessToken(ctx, "jti", expires); err != nil {
+			t.Fatalf("RevokeAccessToken: %v", err)
+		}
+	}
+	if revoked, err := s.AccessTokenRevoked(ctx, "jti"); err != nil || !revoked {
+		t.Errorf("AccessTokenRevoked: got %v, %v, want true", revoked, err)
+	}
+}
+
+func testAPIKeys(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	if _, err := s.GetAPIKeyByHash(ctx, "hash"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAPIKeyByHash of missing key: got %v, want ErrNotFound", err)
+	}
+
+	key, err := s.CreateAPIKey(ctx, storage.APIKey{
+		Name: "ingest", Prefix: "mk_abc", Scopes: []string{"movies:read", "movies:write"}, Hash: "hash",
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if key.ID == 0 || key.CreatedAt.IsZero() || key.LastUsedAt != nil {
+		t.Errorf("CreateAPIKey: got %+v", key)
+	}
+
+	if err := s.TouchAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+	got, err := s.GetAPIKeyByHash(ctx, "hash")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if got.ID != key.ID || got.Name != "ingest" || got.Prefix != "mk_abc" ||
+		!slices.Equal(got.Scopes, []string{"movies:read", "movies:write"}) || got.LastUsedAt == nil {
+		t.Errorf("GetAPIKeyByHash: got %+v after touching", got)
+	}
+
+	keys, err := s.GetAPIKeys(ctx)
+	if err != nil || len(keys) != 1 || keys[0].ID != key.ID {
+		t.Fatalf("GetAPIKeys: got %+v, %v", keys, err)
+	}
+
+	if err := s.DeleteAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("DeleteAPIKey: %v", err)
+	}
+	if _, err := s.GetAPIKeyByHash(ctx, "hash"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAPIKeyByHash of deleted key: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteAPIKey(ctx, key.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DeleteAPIKey of missing key: got %v, want ErrNotFound", err)
+	}
+}
+
+func testUnknownSortField(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	var sortErr *storage.SortError
+
+	_, err := s.GetMovies(ctx, storage.MovieFilter{}, storage.ParseSort("-rating,rating; DROP TABLE movie"), storage.Page{})
+	if !errors.As(err, &sortErr) || len(sortErr.Allowed) == 0 {
+		t.Errorf("GetMovies: got %v, want SortError", err)
+	}
+	_, err = s.GetActors(ctx, storage.ActorFilter{}, storage.ParseSort("title"), storage.Page{})
+	if !errors.As(err, &sortErr) || sortErr.Field != "title" {
+		t.Errorf("GetActors: got %v, want SortError for title", err)
+	}
+	_, err = s.SearchMovies(ctx, "x", storage.MovieFilter{}, storage.ParseSort("-relevance,description"), storage.Page{})
+	if !errors.As(err, &sortErr) || sortErr.Field != "description" {
+		t.Errorf("SearchMovies: got %v, want SortError for description", err)
+	}
+}
+
+func testActorSorting(t *testing.T, s storage.Storage) {
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+	mustCreateActor(t, s, "Anna Karina", "", "")
+	mustCreateActor(t, s, "Cillian Murphy", "", "")
+	if err := s.CreateMovie(context.Background(), "Troy", "", date("2004-05-14"), 7, storage.Credits(pitt), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"name", []string{"Anna Karina", "Brad Pitt", "Cillian Murphy"}},
+		{"-name", []string{"Cillian Murphy", "Brad Pitt", "Anna Karina"}},
+		{"-movies,name", []string{"Brad Pitt", "Anna Karina", "Cillian Murphy"}},
+	}
+
+	for _, tt := range tests {
+		res, err := s.GetActors(context.Background(), storage.ActorFilter{}, storage.ParseSort(tt.sort), storage.Page{})
+		if err != nil {
+			t.Fatalf("GetActors(%q): %v", tt.sort, err)
+		}
+		var got []string
+		for _, a := range res.Actors {
+			got = append(got, a.Name)
+		}
+		if !equal(got, tt.want) {
+			t.Errorf("sort %q: got %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+
+	// Cursors carry the sort values, so paging by name works too.
+	first, err := s.GetActors(context.Background(), storage.ActorFilter{}, storage.ParseSort("-name"), storage.Page{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	second, err := s.GetActors(context.Background(), storage.ActorFilter{}, storage.ParseSort("-name"), storage.Page{Limit: 2, After: first.NextCursor})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	if len(second.Actors) != 1 || second.Actors[0].Name != "Anna Karina" {
+		t.Errorf("second page by -name: got %+v", second.Actors)
+	}
+}
+
+func testOffsetPagination(t *testing.T, s storage.Storage) {
+	for _, title := range []string{"A", "B", "C", "D", "E"} {
+		mustCreateMovie(t, s, title, "", "2000-01-01", 5)
+	}
+
+	page := mustGetMoviesPage(t, s, "title", storage.Page{Limit: 2, Offset: 2})
+	if got := titles(page.Movies); !equal(got, []string{"C", "D"}) {
+		t.Errorf("got %v, want [C D]", got)
+	}
+	if page.Total != 5 {
+		t.Errorf("got total %d, want 5", page.Total)
+	}
+	if page.NextCursor == "" || page.PrevCursor == "" {
+		t.Errorf("want both cursors, got next=%q prev=%q", page.NextCursor, page.PrevCursor)
+	}
+
+	page = mustGetMoviesPage(t, s, "title", storage.Page{Limit: 2, Offset: 10})
+	if len(page.Movies) != 0 || page.Total != 5 {
+		t.Errorf("past the end: got %v of %d", titles(page.Movies), page.Total)
+	}
+}
+
+// testCursorPagination walks the list forwards and back again with ties on
+// the sort key, which only the ID tie-breaker can order.
+func testCursorPagination(t *testing.T, s storage.Storage) {
+	ratings := map[string]int{"A": 9, "B": 7, "C": 7, "D": 7, "E": 3, "F": 1, "G": 1}
+	for _, title := range []string{"A", "B", "C", "D", "E", "F", "G"} {
+		mustCreateMovie(t, s, title, "", "2000-01-01", ratings[title])
+	}
+	want := titles(mustGetMovies(t, s, "-rating"))
+
+	var forward, last []string
+	page := storage.Page{Limit: 3}
+	for i := 0; ; i++ {
+		if i > len(want) {
+			t.Fatal("forward pagination does not terminate")
+		}
+		res := mustGetMoviesPage(t, s, "-rating", page)
+		if res.Total != len(want) {
+			t.Errorf("got total %d, want %d", res.Total, len(want))
+		}
+		if i == 0 && res.PrevCursor != "" {
+			t.Errorf("first page has prev cursor %q", res.PrevCursor)
+		}
+		last = titles(res.Movies)
+		forward = append(forward, last...)
+		if res.NextCursor == "" {
+			page = storage.Page{Limit: 3, Before: res.PrevCursor}
+			break
+		}
+		page = storage.Page{Limit: 3, After: res.NextCursor}
+	}
+	if !equal(forward, want) {
+		t.Fatalf("forward: got %v, want %v", forward, want)
+	}
+
+	backward := last
+	for i := 0; page.Before != ""; i++ {
+		if i > len(want) {
+			t.Fatal("backward pagination does not terminate")
+		}
+		res := mustGetMoviesPage(t, s, "-rating", page)
+		if res.NextCursor == "" {
+			t.Errorf("page before %q has no next cursor", page.Before)
+		}
+		backward = append(titles(res.Movies), backward...)
+		page = storage.Page{Limit: 3, Before: res.PrevCursor}
+	}
+	if !equal(backward, want) {
+		t.Fatalf("backward: got %v, want %v", backward, want)
+	}
+}
+
+func testActorPagination(t *testing.T, s storage.Storage) {
+	for _, name := range []string{"A", "B", "C"} {
+		mustCreateActor(t, s, name, "", "")
+	}
+
+	first, err := s.GetActors(context.Background(), storage.ActorFilter{}, nil, storage.Page{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	if len(first.Actors) != 2 || first.Total != 3 || first.NextCursor == "" {
+		t.Fatalf("first page: got %d actors of %d, next %q", len(first.Actors), first.Total, first.NextCursor)
+	}
+
+	second, err := s.GetActors(context.Background(), storage.ActorFilter{}, nil, storage.Page{Limit: 2, After: first.NextCursor})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	if len(second.Actors) != 1 || second.Actors[0].Name != "C" || second.NextCursor != "" {
+		t.Fatalf("second page: got %+v", second)
+	}
+}
+
+func testInvalidCursor(t *testing.T, s storage.Storage) {
+	mustCreateMovie(t, s, "Fight Club", "", "1999-09-10", 10)
+	mustCreateMovie(t, s, "Heat", "", "1995-12-15", 8)
+
+	_, err := s.GetMovies(context.Background(), storage.MovieFilter{}, storage.ParseSort("-rating"), storage.Page{Limit: 1, After: "not a cursor"})
+	if !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("GetMovies with garbage cursor: got %v, want ErrInvalidCursor", err)
+	}
+
+	// A cursor taken under one sort order does not fit another.
+	page := mustGetMoviesPage(t, s, "title", storage.Page{Limit: 1})
+	_, err = s.GetMovies(context.Background(), storage.MovieFilter{}, storage.ParseSort("-rating"), storage.Page{Limit: 1, After: page.NextCursor})
+	if !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("GetMovies with cursor from another sort: got %v, want ErrInvalidCursor", err)
+	}
+
+	_, err = s.GetMovies(context.Background(), storage.MovieFilter{}, storage.ParseSort("-rating"), storage.Page{Limit: -1})
+	if !errors.Is(err, storage.ErrValidation) {
+		t.Errorf("GetMovies with negative limit: got %v, want ErrValidation", err)
+	}
+}
+
+func testSearch(t *testing.T, s storage.Storage) {
+	pitt := mustCreateActor(t, s, "Brad Pitt", "", "")
+	norton := mustCreateActor(t, s, "Edward Norton", "", "")
+	ctx := context.Background()
+
+	if err := s.CreateMovie(ctx, "Fight Club", "An insomniac office worker", date("1999-09-10"), 10, storage.Credits(pitt, norton), nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	if err := s.CreateMovie(ctx, "Бойцовский клуб", "Страховой работник разрушает рутину", date("1999-09-10"), 10, nil, nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+	if err := s.CreateMovie(ctx, "Alien", "In space no one can hear you scream", date("1979-05-25"), 9, nil, nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"fight", []string{"Fight Club"}},
+		{"FIGHT CLUB", []string{"Fight Club"}},
+		{"бойцовский", []string{"Бойцовский клуб"}},
+		{"БОЙЦОВСКИЙ КЛУБ", []string{"Бойцовский клуб"}},
+		{"Fihgt Club", []string{"Fight Club"}},
+		{"Brad Pit", []string{"Fight Club"}},
+		{"norton", []string{"Fight Club"}},
+		{"scream space", []string{"Alien"}},
+		{"рутину", []string{"Бойцовский клуб"}},
+		{"zzzz", nil},
+		{"%", nil},
+		{"_", nil},
+	}
+
+	for _, tt := range tests {
+		res, err := s.SearchMovies(ctx, tt.search, storage.MovieFilter{}, nil, storage.Page{})
+		if err != nil {
+			t.Fatalf("SearchMovies(%q): %v", tt.search, err)
+		}
+
+		var got []string
+		for _, r := range res.Results {
+			got = append(got, r.Title)
+			if r.Score <= 0 {
+				t.Errorf("SearchMovies(%q): %q has score %v", tt.search, r.Title, r.Score)
+			}
+			if len(r.Highlights) == 0 {
+				t.Errorf("SearchMovies(%q): %q has no highlights", tt.search, r.Title)
+			}
+		}
+		if !equal(got, tt.want) || res.Total != len(tt.want) {
+			t.Errorf("SearchMovies(%q): got %v (total %d), want %v", tt.search, got, res.Total, tt.want)
+		}
+	}
+
+	res, err := s.SearchMovies(ctx, "pitt", storage.MovieFilter{}, nil, storage.Page{})
+	if err != nil {
+		t.Fatalf("SearchMovies: %v", err)
+	}
+	if len(res.Results) != 1 || !contains(res.Results[0].Highlights, "Brad <mark>Pitt</mark>") {
+		t.Errorf("SearchMovies(pitt): got highlights %+v", res.Results)
+	}
+}
+
+// testSearchHighlightEscaping checks that highlights escape the stored text,
+// which clients render as HTML around the <mark> tags.
+func testSearchHighlightEscaping(t *testing.T, s storage.Storage) {
+	mustCreateMovie(t, s, "<img src=x onerror=alert(1)> Matrix", "Neo & <b>the Matrix</b>", "1999-03-31", 9)
+
+	res, err := s.SearchMovies(context.Background(), "matrix", storage.MovieFilter{}, nil, storage.Page{})
+	if err != nil {
+		t.Fatalf("SearchMovies: %v", err)
+	}
+	if len(res.Results) != 1 {
+		t.Fatalf("SearchMovies(matrix): got %d results, want 1", len(res.Results))
+	}
+	want := []string{
+		"&lt;img src=x onerror=alert(1)&gt; <mark>Matrix</mark>",
+		"Neo &amp; &lt;b&gt;the <mark>Matrix</mark>&lt;/b&gt;",
+	}
+	if got := res.Results[0].Highlights; !equal(got, want) {
+		t.Errorf("SearchMovies(matrix): got highlights %q, want %q", got, want)
+	}
+}
+
+func testSearchRanking(t *testing.T, s storage.Storage) {
+	mustCreateMovie(t, s, "Heap", "", "2000-01-01", 9)
+	mustCreateMovie(t, s, "Heat", "", "1995-12-15", 8)
+
+	res, err := s.SearchMovies(context.Background(), "heat", storage.MovieFilter{}, nil, storage.Page{})
+	if err != nil {
+		t.Fatalf("SearchMovies: %v", err)
+	}
+	if len(res.Results) != 2 || res.Results[0].Title != "Heat" || res.Results[0].Score <= res.Results[1].Score {
+		t.Errorf("by relevance: got %+v", res.Results)
+	}
+
+	res, err = s.SearchMovies(context.Background(), "heat", storage.MovieFilter{}, storage.ParseSort("-rating"), storage.Page{})
+	if err != nil {
+		t.Fatalf("SearchMovies: %v", err)
+	}
+	if len(res.Results) != 2 || res.Results[0].Title != "Heap" {
+		t.Errorf("by rating: got %+v", res.Results)
+	}
+}
+
+func testSearchPaging(t *testing.T, s storage.Storage) {
+	for _, title := range []string{"Club A", "Club B", "Club C"} {
+		mustCreateMovie(t, s, title, "", "2000-01-01", 5)
+	}
+
+	res, err := s.SearchMovies(context.Background(), "club", storage.MovieFilter{}, storage.ParseSort("title"), storage.Page{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("SearchMovies: %v", err)
+	}
+	if len(res.Results) != 1 || res.Results[0].Title != "Club B" || res.Total != 3 {
+		t.Errorf("got %+v", res)
+	}
+
+	_, err = s.SearchMovies(context.Background(), "club", storage.MovieFilter{}, nil, storage.Page{Limit: 1, After: "x"})
+	if !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("SearchMovies with cursor: got %v, want ErrInvalidCursor", err)
+	}
+}
+
+func mustCreateMovie(t *testing.T, s storage.Storage, title, description, releaseDate string, rating int) {
+	t.Helper()
+	if err := s.CreateMovie(context.Background(), title, description, date(releaseDate), rating, nil, nil); err != nil {
+		t.Fatalf("CreateMovie: %v", err)
+	}
+}
+
+// mustCreateGenre creates a genre and returns its ID, looked up by name.
+func mustCreateGenre(t *testing.T, s storage.Storage, name string) int {
+	t.Helper()
+	if err := s.CreateGenre(context.Background(), name); err != nil {
+		t.Fatalf("CreateGenre: %v", err)
+	}
+
+	genres, err := s.GetGenres(context.Background())
+	if err != nil {
+		t.Fatalf("GetGenres: %v", err)
+	}
+	for _, g := range genres {
+		if g.Name == name {
+			return g.ID
+		}
+	}
+	t.Fatalf("CreateGenre(%s) did not create it", name)
+	return 0
+}
+
+// mustCreateActor creates an actor and returns its ID. Storage.CreateActor
+// does not report the ID, so it is looked up by the highest ID afterwards.
+func mustCreateActor(t *testing.T, s storage.Storage, name, gender, birthday string) int {
+	t.Helper()
+	if err := s.CreateActor(context.Background(), name, gender, date(birthday)); err != nil {
+		t.Fatalf("CreateActor: %v", err)
+	}
+
+	id := 0
+	for _, a := range mustGetActors(t, s) {
+		if a.ID > id {
+			id = a.ID
+		}
+	}
+	return id
+}
+
+// mustCreatePerson creates a person and returns their ID. Like actors, the
+// person is found by the highest ID, so they are created as an actor first
+// and then moved to knownFor.
+func mustCreatePerson(t *testing.T, s storage.Storage, name string, knownFor storage.Department) int {
+	t.Helper()
+	id := mustCreateActor(t, s, name, "", "")
+	if err := s.UpdatePerson(context.Background(), id, 0, "", "", storage.Date{}, knownFor); err != nil {
+		t.Fatalf("UpdatePerson: %v", err)
+	}
+	return id
+}
+
+// date parses a date literal of the suite; "" is no date.
+func date(s string) storage.Date {
+	d, err := storage.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func mustGetMovies(t *testing.T, s storage.Storage, sort string) []storage.MovieInfo {
+	t.Helper()
+	return mustGetMoviesPage(t, s, sort, storage.Page{}).Movies
+}
+
+func mustGetMoviesPage(t *testing.T, s storage.Storage, sort string, page storage.Page) storage.MoviesPage {
+	t.Helper()
+	movies, err := s.GetMovies(context.Background(), storage.MovieFilter{}, storage.ParseSort(sort), page)
+	if err != nil {
+		t.Fatalf("GetMovies: %v", err)
+	}
+	return movies
+}
+
+func mustGetActors(t *testing.T, s storage.Storage) []storage.ActorInfo {
+	t.Helper()
+	actors, err := s.GetActors(context.Background(), storage.ActorFilter{}, nil, storage.Page{})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	return actors.Actors
+}
+
+func actorByID(t *testing.T, actors []storage.ActorInfo, id int) storage.ActorInfo {
+	t.Helper()
+	for _, a := range actors {
+		if a.ID == id {
+			return a
+		}
+	}
+	t.Fatalf("actor %d not found", id)
+	return storage.ActorInfo{}
+}
+
+func titles(movies []storage.MovieInfo) []string {
+	var res []string
+	for _, m := range movies {
+		res = append(res, m.Title)
+	}
+	return res
+}
+
+func names(actors []storage.ActorName) []string {
+	var res []string
+	for _, a := range actors {
+		res = append(res, a.Name)
+	}
+	return res
+}
+
+func movieTitles(movies []storage.MovieTitle) []string {
+	var res []string
+	for _, m := range movies {
+		res = append(res, m.Title)
+	}
+	return res
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, v := range a {
+		seen[v]++
+	}
+	for _, v := range b {
+		if seen[v] == 0 {
+			return false
+		}
+		seen[v]--
+	}
+	return true
+}
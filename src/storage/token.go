@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// RefreshToken is a stored refresh token. Only the SHA-256 of the token is
+// kept. Every refresh replaces the token with the next one of its family, so
+// a family is one sign-in; a replaced token that comes back revokes the
+// whole family.
+type RefreshToken struct {
+	Hash      string
+	UserID    int
+	Family    string
+	ExpiresAt time.Time
+}
+
+// ErrInvalidToken is returned for refresh tokens that are unknown, expired
+// or revoked.
+var ErrInvalidToken = errors.New("invalid token")
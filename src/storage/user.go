@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is an account that may change the catalogue. Usernames are unique
+// regardless of case; disabled users cannot sign in.
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Role         UserRole  `json:"role"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	PasswordHash []byte    `json:"-"`
+}
+
+// UserRole decides what a user may do; tools.rolePermissions lists the
+// permissions of each role.
+type UserRole string
+
+const (
+	UserRoleViewer UserRole = "viewer"
+	UserRoleEditor UserRole = "editor"
+	UserRoleAdmin  UserRole = "admin"
+)
+
+func (r UserRole) Valid() bool {
+	switch r {
+	case UserRoleViewer, UserRoleEditor, UserRoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (r *UserRole) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("role must be a string")
+	}
+	if s != "" && !UserRole(s).Valid() {
+		return fmt.Errorf("unknown role %q, allowed roles: viewer, editor, admin", s)
+	}
+	*r = UserRole(s)
+	return nil
+}
+
+// ErrUserExists is returned when a user is created with the username of
+// another user. Usernames are compared case-insensitively.
+var ErrUserExists error = &kindError{kind: ErrConflict, msg: "user already exists"}
+
+// Passwords are hashed with bcrypt, which only reads the first 72 bytes.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// ValidPassword reports whether a password is MinPasswordLength to
+// MaxPasswordLength bytes long.
+func ValidPassword(password string) bool {
+	return len(password) >= MinPasswordLength && len(password) <= MaxPasswordLength
+}
+
+// HashPassword hashes a password with bcrypt for storing in a User. Passwords
+// longer than 72 bytes are rejected.
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// CheckPassword reports whether password is the password of the user.
+func (u User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) == nil
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"slices"
+
+	"vktest/src/storage"
+)
+
+// Permission is an operation that Auth.Require guards.
+type Permission string
+
+const (
+	// PermRead lets through reads of the catalogue.
+	PermRead Permission = "read"
+	// PermEdit lets through creating and changing movies, people and
+	// genres, including casts, crews and tags.
+	PermEdit Permission = "edit"
+	// PermDelete lets through deleting movies, people and genres.
+	PermDelete Permission = "delete"
+	// PermAccount lets a user change their own password.
+	PermAccount Permission = "account"
+	// PermManageUsers lets through managing every user account.
+	PermManageUsers Permission = "manage_users"
+	// PermManageKeys lets through creating, listing and revoking API keys.
+	PermManageKeys Permission = "manage_keys"
+)
+
+// Resource is what a route reads or changes. API keys are scoped to
+// resources.
+type Resource string
+
+const (
+	ResourceMovies Resource = "movies"
+	ResourceActors Resource = "actors"
+	ResourcePeople Resource = "people"
+	ResourceGenres Resource = "genres"
+	// ResourceUsers is user accounts and API keys; no scope covers it.
+	ResourceUsers Resource = "users"
+)
+
+// scopedResources and scopeActions make up the API key scopes.
+var (
+	scopedResources = []Resource{ResourceMovies, ResourceActors, ResourcePeople, ResourceGenres}
+	scopeActions    = []struct {
+		perm   Permission
+		action string
+	}{
+		{PermRead, "read"},
+		{PermEdit, "write"},
+		{PermDelete, "delete"},
+	}
+)
+
+// Scope returns the API key scope, "resource:action", that lets through perm
+// on resource, or "" if no scope does.
+func Scope(resource Resource, perm Permission) string {
+	if !slices.Contains(scopedResources, resource) {
+		return ""
+	}
+	for _, a := range scopeActions {
+		if a.perm == perm {
+			return string(resource) + ":" + a.action
+		}
+	}
+	return ""
+}
+
+// Scopes lists every API key scope, e.g. movies:read or actors:write.
+func Scopes() []string {
+	var scopes []string
+	for _, resource := range scopedResources {
+		for _, a := range scopeActions {
+			scopes = append(scopes, Scope(resource, a.perm))
+		}
+	}
+	return scopes
+}
+
+// anonymous is the role of requests without credentials.
+const anonymous storage.UserRole = ""
+
+// rolePermissions is the role matrix: everything each role may do. Roles
+// missing here may do nothing.
+var rolePermissions = map[storage.UserRole][]Permission{
+	anonymous:              {PermRead},
+	storage.UserRoleViewer: {PermRead, PermAccount},
+	storage.UserRoleEditor: {PermRead, PermAccount, PermEdit},
+	storage.UserRoleAdmin:  {PermRead, PermAccount, PermEdit, PermDelete, PermManageUsers, PermManageKeys},
+}
+
+// Allowed reports whether the role has the permission.
+func Allowed(role storage.UserRole, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
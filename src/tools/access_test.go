@@ -0,0 +1,73 @@
+package tools_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+func TestRequireRoleMatrix(t *testing.T) {
+	s := storage.NewMemStorage()
+	auth := tools.NewAuth(s, s, tools.NewTokens(s, []tools.SigningKey{newKey}))
+
+	roles := []storage.UserRole{storage.UserRoleViewer, storage.UserRoleEditor, storage.UserRoleAdmin}
+	for _, role := range roles {
+		mustCreateUser(t, s, string(role), role)
+	}
+
+	const (
+		ok        = http.StatusOK
+		forbidden = http.StatusForbidden
+		unauth    = http.StatusUnauthorized
+	)
+	tests := []struct {
+		perm     tools.Permission
+		resource tools.Resource
+		// want is the status for anonymous, viewer, editor and admin.
+		want [4]int
+	}{
+		{tools.PermRead, tools.ResourceMovies, [4]int{ok, ok, ok, ok}},
+		{tools.PermEdit, tools.ResourceMovies, [4]int{unauth, forbidden, ok, ok}},
+		{tools.PermDelete, tools.ResourceMovies, [4]int{unauth, forbidden, forbidden, ok}},
+		{tools.PermAccount, tools.ResourceUsers, [4]int{unauth, ok, ok, ok}},
+		{tools.PermManageUsers, tools.ResourceUsers, [4]int{unauth, forbidden, forbidden, ok}},
+		{tools.PermManageKeys, tools.ResourceUsers, [4]int{unauth, forbidden, forbidden, ok}},
+	}
+	for _, tt := range tests {
+		for i, role := range append([]storage.UserRole{""}, roles...) {
+			name := string(role)
+			header := http.Header{}
+			if role == "" {
+				name = "anonymous"
+			} else {
+				r, _ := http.NewRequest(http.MethodGet, "/", nil)
+				r.SetBasicAuth(string(role), testPassword)
+				header = r.Header
+			}
+
+			t.Run(string(tt.perm)+"/"+name, func(t *testing.T) {
+				if code := serve(auth, tt.resource, tt.perm, header); code != tt.want[i] {
+					t.Errorf("Require = %d, want %d", code, tt.want[i])
+				}
+			})
+		}
+	}
+}
+
+func TestRequireDisabledUser(t *testing.T) {
+	s := storage.NewMemStorage()
+	auth := tools.NewAuth(s, s, tools.NewTokens(s, []tools.SigningKey{newKey}))
+	user := mustCreateUser(t, s, "alice", storage.UserRoleAdmin)
+	if err := s.SetUserDisabled(context.Background(), user.ID, true); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("alice", testPassword)
+	if code := serve(auth, tools.ResourceMovies, tools.PermEdit, r.Header); code != http.StatusUnauthorized {
+		t.Errorf("Require = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
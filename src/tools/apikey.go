@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"context"
+
+	"vktest/src/storage"
+)
+
+// API keys are random, so a fast hash is enough to store them; the prefix
+// makes them easy to spot in configs and logs.
+const (
+	apiKeyPrefix      = "mk_"
+	apiKeyShownPrefix = len(apiKeyPrefix) + 8
+)
+
+// APIKeys looks up the API keys that Auth accepts in the X-API-Key header.
+type APIKeys interface {
+	GetAPIKeyByHash(ctx context.Context, hash string) (storage.APIKey, error)
+	TouchAPIKey(ctx context.Context, id int) error
+}
+
+// NewAPIKey returns a new key and its stored form. The key itself is not
+// stored, so it can only be shown once.
+func NewAPIKey(name string, scopes []string) (string, storage.APIKey, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", storage.APIKey{}, err
+	}
+	key := apiKeyPrefix + secret
+	return key, storage.APIKey{
+		Name:   name,
+		Prefix: key[:apiKeyShownPrefix],
+		Scopes: scopes,
+		Hash:   hashToken(key),
+	}, nil
+}
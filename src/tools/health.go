@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Pinger is a dependency that Health watches.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Health pings the storage in the background, so that the service keeps
+// running through an outage and reports it instead of failing on it.
+type Health struct {
+	pinger Pinger
+
+	mu    sync.Mutex
+	err   error
+	since time.Time
+}
+
+// HealthResponse is the body of the health endpoint. Since is when the
+// status last changed.
+type HealthResponse struct {
+	Status string    `json:"status"`
+	Since  time.Time `json:"since"`
+}
+
+func NewHealth(pinger Pinger) *Health {
+	return &Health{pinger: pinger, since: time.Now()}
+}
+
+// Watch pings every interval until ctx is done, logging the changes of
+// status.
+func (h *Health) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := h.pinger.Ping(pingCtx)
+		cancel()
+		h.set(err)
+	}
+}
+
+func (h *Health) set(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case err != nil && h.err == nil:
+		log.Printf("Storage unreachable, serving degraded: %s\n", err)
+		h.since = time.Now()
+	case err == nil && h.err != nil:
+		log.Printf("Storage reachable again after %s\n", time.Since(h.since).Round(time.Second))
+		h.since = time.Now()
+	}
+	h.err = err
+}
+
+// ServeHTTP responds with 200 and status "ok", or with 503 and status
+// "degraded" while the storage is unreachable.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	resp := HealthResponse{Status: "ok", Since: h.since}
+	status := http.StatusOK
+	if h.err != nil {
+		resp.Status = "degraded"
+		status = http.StatusServiceUnavailable
+	}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
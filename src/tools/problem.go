@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"vktest/src/storage"
+)
+
+// ErrorCode tells clients what went wrong. Codes are stable; the details
+// that go with them are for people and may change.
+type ErrorCode string
+
+const (
+	CodeInvalidBody          ErrorCode = "invalid_body"
+	CodeInvalidParameter     ErrorCode = "invalid_parameter"
+	CodeValidation           ErrorCode = "validation_failed"
+	CodeUnknownActors        ErrorCode = "unknown_actors"
+	CodeUnknownGenres        ErrorCode = "unknown_genres"
+	CodeUnknownPeople        ErrorCode = "unknown_people"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeConflict             ErrorCode = "conflict"
+	CodePreconditionFailed   ErrorCode = "precondition_failed"
+	CodePreconditionRequired ErrorCode = "precondition_required"
+	CodeMethodNotAllowed     ErrorCode = "method_not_allowed"
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeInvalidToken         ErrorCode = "invalid_token"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeInternal             ErrorCode = "internal_error"
+	CodeUnavailable          ErrorCode = "unavailable"
+)
+
+// FieldError is what is wrong with one field of a request body or one query
+// parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Problem is an RFC 7807 problem details response. Code, RequestID, Errors
+// and the unknown IDs are extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	ActorIDs  []int        `json:"actor_ids,omitempty"`
+	GenreIDs  []int        `json:"genre_ids,omitempty"`
+	PersonIDs []int        `json:"person_ids,omitempty"`
+}
+
+// WriteProblem responds with the problem. The type is about:blank, so the
+// title is the status text; the request ID is the one RequestID set.
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.RequestID = w.Header().Get(requestIDHeader)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error is http.Error for problems.
+func Error(w http.ResponseWriter, code ErrorCode, detail string, status int) {
+	WriteProblem(w, Problem{Status: status, Code: code, Detail: detail})
+}
+
+// InternalError logs err with the request ID and responds with 500, or with
+// 503 when the storage cannot be reached for now. The error itself is not
+// sent, as it may tell more about the service than clients should know.
+func InternalError(w http.ResponseWriter, err error) {
+	log.Printf("request %s: %s\n", w.Header().Get(requestIDHeader), err.Error())
+	if errors.Is(err, storage.ErrUnavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+		Error(w, CodeUnavailable, "The service is unavailable, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	Error(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+}
+
+// retryAfterSeconds is how long clients should wait on 503, about the
+// interval the health of the storage is checked at.
+const retryAfterSeconds = 5
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID gives every request an ID, in the X-Request-ID response header
+// and the request context. A well-formed X-Request-ID of the request is kept,
+// so IDs can be followed across services.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			var err error
+			if id, err = randomString(12); err != nil {
+				InternalError(w, err)
+				return
+			}
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns the ID that RequestID gave the request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
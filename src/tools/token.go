@@ -0,0 +1,261 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"vktest/src/storage"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// SigningKey is an HS256 key for access tokens, named by the kid header.
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseSigningKeys reads keys written as "kid:secret,kid:secret". The first
+// key signs new tokens; all of them verify, so a key can be rotated by
+// putting the new one first and dropping the old one once its tokens have
+// expired.
+func ParseSigningKeys(s string) ([]SigningKey, error) {
+	var keys []SigningKey
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("signing key %q must be kid:secret", entry)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("signing key %q is given twice", id)
+		}
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("signing key %q must be at least 32 bytes long", id)
+		}
+		seen[id] = true
+		keys = append(keys, SigningKey{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+// NewSigningKey returns a random key, for running without configured keys.
+// Its tokens do not outlive the process.
+func NewSigningKey() (SigningKey, error) {
+	id, err := randomString(8)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{ID: id, Secret: secret}, nil
+}
+
+// TokenStore keeps the refresh tokens and the revoked access tokens.
+type TokenStore interface {
+	GetUser(ctx context.Context, id int) (storage.User, error)
+	CreateRefreshToken(ctx context.Context, token storage.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, hash string, next storage.RefreshToken) (storage.RefreshToken, error)
+	RevokeRefreshTokens(ctx context.Context, hash string) error
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	AccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// Tokens issues short-lived JWT access tokens with rotating refresh tokens.
+type Tokens struct {
+	store TokenStore
+	keys  []SigningKey
+}
+
+func NewTokens(store TokenStore, keys []SigningKey) *Tokens {
+	return &Tokens{store: store, keys: keys}
+}
+
+// TokenPair is the response of signing in and of refreshing.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AccessClaims are the claims of an access token. The subject is the user
+// ID.
+type AccessClaims struct {
+	Name string           `json:"name"`
+	Role storage.UserRole `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// User returns the user the token was issued to, as of issuing.
+func (c *AccessClaims) User() storage.User {
+	id, _ := strconv.Atoi(c.Subject)
+	return storage.User{ID: id, Username: c.Name, Role: c.Role}
+}
+
+// Issue signs the user in with a new refresh token family.
+func (t *Tokens) Issue(ctx context.Context, user storage.User) (TokenPair, error) {
+	family, err := randomString(16)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, stored, err := newRefreshToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	stored.UserID, stored.Family = user.ID, family
+
+	if err := t.store.CreateRefreshToken(ctx, stored); err != nil {
+		return TokenPair{}, err
+	}
+	return t.pair(user, refresh)
+}
+
+// Refresh swaps a refresh token for a new pair. The user is read again, so
+// role changes apply and disabled users are signed out.
+func (t *Tokens) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	refresh, next, err := newRefreshToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	next, err = t.store.RotateRefreshToken(ctx, hashToken(refreshToken), next)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	user, err := t.store.GetUser(ctx, next.UserID)
+	if errors.Is(err, storage.ErrNotFound) || err == nil && user.Disabled {
+		if err := t.store.RevokeRefreshTokens(ctx, next.Hash); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, storage.ErrInvalidToken
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return t.pair(user, refresh)
+}
+
+// Revoke signs out: it revokes the family of the refresh token and, if
+// claims is not nil, the access token.
+func (t *Tokens) Revoke(ctx context.Context, claims *AccessClaims, refreshToken string) error {
+	if refreshToken != "" {
+		if err := t.store.RevokeRefreshTokens(ctx, hashToken(refreshToken)); err != nil {
+			return err
+		}
+	}
+	if claims != nil {
+		return t.store.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time)
+	}
+	return nil
+}
+
+// Verify checks the signature, expiry and revocation of an access token.
+// Invalid tokens give storage.ErrInvalidToken.
+func (t *Tokens) Verify(ctx context.Context, accessToken string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, t.key,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", storage.ErrInvalidToken, err)
+	}
+
+	revoked, err := t.store.AccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("%w: token is revoked", storage.ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// key finds the verification key of a token by its kid header.
+func (t *Tokens) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, k := range t.keys {
+		if k.ID == kid {
+			return k.Secret, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func (t *Tokens) pair(user storage.User, refreshToken string) (TokenPair, error) {
+	jti, err := randomString(16)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	now := time.Now()
+	claims := AccessClaims{
+		Name: user.Username,
+		Role: user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	}
+
+	key := t.keys[0]
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Secret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  signed,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// newRefreshToken returns a random refresh token and its stored form, to be
+// completed with the user and family.
+func newRefreshToken() (string, storage.RefreshToken, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", storage.RefreshToken{}, err
+	}
+	return token, storage.RefreshToken{
+		Hash:      hashToken(token),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,181 @@
+package tools_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vktest/src/storage"
+	"vktest/src/tools"
+)
+
+var (
+	oldKey = tools.SigningKey{ID: "old", Secret: []byte("old-secret-old-secret-old-secret")}
+	newKey = tools.SigningKey{ID: "new", Secret: []byte("new-secret-new-secret-new-secret")}
+)
+
+const testPassword = "correct horse battery"
+
+// mustCreateUser creates a user with testPassword and returns it.
+func mustCreateUser(t *testing.T, s storage.Storage, username string, role storage.UserRole) storage.User {
+	t.Helper()
+	ctx := context.Background()
+
+	hash, err := storage.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if err := s.CreateUser(ctx, username, hash, role); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := s.GetUserByName(ctx, username)
+	if err != nil {
+		t.Fatalf("GetUserByName: %v", err)
+	}
+	return user
+}
+
+func mustIssue(t *testing.T, tokens *tools.Tokens, user storage.User) tools.TokenPair {
+	t.Helper()
+	pair, err := tokens.Issue(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return pair
+}
+
+// serve sends a request to a handler guarded by auth.Require and returns the
+// status. The handler itself answers 200.
+func serve(auth *tools.Auth, resource tools.Resource, perm tools.Permission, header http.Header) int {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	auth.Require(resource, perm, ok)(w, r)
+	return w.Code
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestVerifyAfterRotation(t *testing.T) {
+	s := storage.NewMemStorage()
+	user := mustCreateUser(t, s, "alice", storage.UserRoleViewer)
+	pair := mustIssue(t, tools.NewTokens(s, []tools.SigningKey{oldKey}), user)
+
+	rotated := tools.NewTokens(s, []tools.SigningKey{newKey, oldKey})
+	claims, err := rotated.Verify(context.Background(), pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify with the old key still configured: %v", err)
+	}
+	if claims.User().ID != user.ID {
+		t.Errorf("subject = %d, want %d", claims.User().ID, user.ID)
+	}
+	if code := serve(tools.NewAuth(s, s, rotated), tools.ResourceMovies, tools.PermAccount, bearer(pair.AccessToken)); code != http.StatusOK {
+		t.Errorf("Require = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	s := storage.NewMemStorage()
+	user := mustCreateUser(t, s, "alice", storage.UserRoleViewer)
+	tokens := tools.NewTokens(s, []tools.SigningKey{newKey})
+
+	forged := tools.SigningKey{ID: newKey.ID, Secret: []byte("forged-secret-forged-secret-forg")}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown kid", mustIssue(t, tools.NewTokens(s, []tools.SigningKey{oldKey}), user).AccessToken},
+		{"bad signature", mustIssue(t, tools.NewTokens(s, []tools.SigningKey{forged}), user).AccessToken},
+		{"not a jwt", "not-a-jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokens.Verify(context.Background(), tt.token); !errors.Is(err, storage.ErrInvalidToken) {
+				t.Errorf("Verify = %v, want ErrInvalidToken", err)
+			}
+			if code := serve(tools.NewAuth(s, s, tokens), tools.ResourceMovies, tools.PermRead, bearer(tt.token)); code != http.StatusUnauthorized {
+				t.Errorf("Require = %d, want %d", code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	s := storage.NewMemStorage()
+	user := mustCreateUser(t, s, "alice", storage.UserRoleViewer)
+	tokens := tools.NewTokens(s, []tools.SigningKey{newKey})
+	ctx := context.Background()
+
+	first := mustIssue(t, tokens, user)
+	second, err := tokens.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("Refresh returned the same refresh token")
+	}
+
+	if _, err := tokens.Refresh(ctx, first.RefreshToken); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Fatalf("reused Refresh = %v, want ErrInvalidToken", err)
+	}
+	if _, err := tokens.Refresh(ctx, second.RefreshToken); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Errorf("Refresh after reuse = %v, want ErrInvalidToken", err)
+	}
+
+	// Other sign-ins of the user are separate families.
+	other := mustIssue(t, tokens, user)
+	if _, err := tokens.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("Refresh of another family: %v", err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s := storage.NewMemStorage()
+	user := mustCreateUser(t, s, "alice", storage.UserRoleViewer)
+	tokens := tools.NewTokens(s, []tools.SigningKey{newKey})
+	ctx := context.Background()
+
+	pair := mustIssue(t, tokens, user)
+	claims, err := tokens.Verify(ctx, pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := tokens.Revoke(ctx, claims, pair.RefreshToken); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	if _, err := tokens.Verify(ctx, pair.AccessToken); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Errorf("Verify after Revoke = %v, want ErrInvalidToken", err)
+	}
+	if _, err := tokens.Refresh(ctx, pair.RefreshToken); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Errorf("Refresh after Revoke = %v, want ErrInvalidToken", err)
+	}
+	if code := serve(tools.NewAuth(s, s, tokens), tools.ResourceMovies, tools.PermRead, bearer(pair.AccessToken)); code != http.StatusUnauthorized {
+		t.Errorf("Require after Revoke = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireMalformedAuthorization(t *testing.T) {
+	s := storage.NewMemStorage()
+	auth := tools.NewAuth(s, s, tools.NewTokens(s, []tools.SigningKey{newKey}))
+
+	if code := serve(auth, tools.ResourceMovies, tools.PermRead, nil); code != http.StatusOK {
+		t.Fatalf("anonymous read = %d, want %d", code, http.StatusOK)
+	}
+	for _, value := range []string{"Bearer", "Bearer ", "Basic", "Basic !!!", "Token abc", "garbage"} {
+		t.Run(value, func(t *testing.T) {
+			code := serve(auth, tools.ResourceMovies, tools.PermRead, http.Header{"Authorization": {value}})
+			if code != http.StatusUnauthorized {
+				t.Errorf("Require = %d, want %d", code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -1,51 +1,183 @@
 package tools
 
 import (
-	"crypto/sha256"
-	"crypto/subtle"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"vktest/src/storage"
 )
 
-func RequestLogger(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println(
-			"method", r.Method,
-			"path", r.URL.EscapedPath(),
-		)
-		next(w, r)
+// Users looks up the accounts that Auth checks credentials against.
+type Users interface {
+	GetUserByName(ctx context.Context, username string) (storage.User, error)
+}
+
+type Auth struct {
+	users  Users
+	keys   APIKeys
+	tokens *Tokens
+}
+
+func NewAuth(users Users, keys APIKeys, tokens *Tokens) *Auth {
+	return &Auth{users: users, keys: keys, tokens: tokens}
+}
+
+type userKey struct{}
+
+// UserFromContext returns the user that Auth signed the request in as.
+func UserFromContext(ctx context.Context) (storage.User, bool) {
+	user, ok := ctx.Value(userKey{}).(storage.User)
+	return user, ok
+}
+
+// dummyUser is checked against for unknown usernames, so that they take as
+// long to reject as wrong passwords.
+var dummyUser = sync.OnceValue(func() storage.User {
+	hash, err := storage.HashPassword("dummy password")
+	if err != nil {
+		panic(err)
+	}
+	return storage.User{PasswordHash: hash}
+})
+
+// Authenticate checks the username and password of an enabled user. Wrong
+// credentials report false without an error.
+func Authenticate(ctx context.Context, users Users, username, password string) (storage.User, bool, error) {
+	user, err := users.GetUserByName(ctx, username)
+	if errors.Is(err, storage.ErrNotFound) {
+		dummyUser().CheckPassword(password)
+		return storage.User{}, false, nil
+	}
+	if err != nil {
+		return storage.User{}, false, err
 	}
+	if !user.CheckPassword(password) || user.Disabled {
+		return storage.User{}, false, nil
+	}
+	return user, true, nil
 }
 
-func RequestAuth(next http.HandlerFunc) http.HandlerFunc {
+// Require lets through requests whose role has perm on resource. Requests
+// without credentials have the anonymous role; with credentials, basic auth
+// of an enabled user or a Bearer access token, they are signed in. A
+// signed-in user without perm gets 403. Requests with an X-API-Key header
+// need a key with the scope of resource and perm instead.
+func (a *Auth) Require(resource Resource, perm Permission, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Println(
+			"request", RequestIDFromContext(r.Context()),
 			"method", r.Method,
 			"path", r.URL.EscapedPath(),
 		)
 
-		username, password, ok := r.BasicAuth()
-		if ok {
-			cred := username + password
-			credHash := sha256.Sum256([]byte(cred))
-
-			//username = "abc", password = "123"
-			rightHash := [32]byte{108, 161, 61, 82, 202, 112, 200, 131, 224, 240, 187, 16, 30, 66, 90,
-				137, 232, 98, 77, 229, 29, 178, 210, 57, 37, 147, 175, 106, 132, 17, 128, 144}
-			usernameMatch := (subtle.ConstantTimeCompare(credHash[:], rightHash[:]) == 1)
-
-			// if username == "abc" && password == "123" {
-			// 	next(w, r)
-			// 	return
-			// }
-			if usernameMatch {
-				next(w, r)
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			a.requireKey(w, r, key, Scope(resource, perm), next)
+			return
+		}
+
+		var user storage.User
+		if token, ok := BearerToken(r); ok {
+			claims, err := a.tokens.Verify(r.Context(), token)
+			if errors.Is(err, storage.ErrInvalidToken) {
+				log.Println("Unauthorized")
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				Error(w, CodeInvalidToken, "The access token is invalid, expired or revoked", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				InternalError(w, fmt.Errorf("failed to verify token: %w", err))
+				return
+			}
+			user = claims.User()
+		} else {
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				// Malformed credentials do not fall back to anonymous.
+				if r.Header.Get("Authorization") == "" && Allowed(anonymous, perm) {
+					next(w, r)
+					return
+				}
+				unauthorized(w)
+				return
+			}
+
+			var err error
+			user, ok, err = Authenticate(r.Context(), a.users, username, password)
+			if err != nil {
+				InternalError(w, fmt.Errorf("failed to get user: %w", err))
+				return
+			}
+			if !ok {
+				unauthorized(w)
 				return
 			}
 		}
+
+		if !Allowed(user.Role, perm) {
+			log.Println("Forbidden")
+			Error(w, CodeForbidden, "Your role does not allow this", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	}
+}
+
+// requireKey lets the request through if the API key has scope, and records
+// that the key was used.
+func (a *Auth) requireKey(w http.ResponseWriter, r *http.Request, key, scope string, next http.HandlerFunc) {
+	apiKey, err := a.keys.GetAPIKeyByHash(r.Context(), hashToken(key))
+	if errors.Is(err, storage.ErrNotFound) {
 		log.Println("Unauthorized")
+		Error(w, CodeUnauthorized, "Unknown API key", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		InternalError(w, fmt.Errorf("failed to get api key: %w", err))
+		return
+	}
 
-		w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if err := a.keys.TouchAPIKey(r.Context(), apiKey.ID); err != nil {
+		log.Printf("failed to touch api key %s\n", err.Error())
+	}
+	if scope == "" || !slices.Contains(apiKey.Scopes, scope) {
+		log.Println("Forbidden")
+		Error(w, CodeForbidden, "The API key does not have the scope for this", http.StatusForbidden)
+		return
+	}
+	next(w, r)
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func unauthorized(w http.ResponseWriter) {
+	log.Println("Unauthorized")
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+	Error(w, CodeUnauthorized, "Valid credentials are required", http.StatusUnauthorized)
+}
+
+// Deprecated serves a route that is being phased out. Responses carry the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) dates and a Link to the
+// successor route.
+func Deprecated(next http.HandlerFunc, since, sunset time.Time, successor string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", since.Unix()))
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		next(w, r)
 	}
 }